@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -39,7 +40,7 @@ func main() {
 		http.ServeFile(w, r, path)
 	})
 
-	http.Handle("/~watch.js", watchjs.NewServer(watchjs.Config{
+	watchServer, err := watchjs.NewServerContext(context.Background(), watchjs.Config{
 		Monitor: []string{filepath.Join(*monitor, "**")},
 		Ignore:  watchjs.DefaultIgnore,
 		OnChange: func(change watch.Change) (string, watchjs.Action) {
@@ -52,12 +53,16 @@ func main() {
 			}
 			return "/" + filepath.ToSlash(change.Path), watchjs.ReloadBrowser
 		},
-	}))
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	http.Handle("/~watch.js", watchServer)
 
 	url := "http://" + *listen
 	fmt.Println("Listening on:", url)
 	fmt.Println("Monitoring:", *monitor)
-	err := http.ListenAndServe(*listen, nil)
+	err = http.ListenAndServe(*listen, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -18,11 +20,25 @@ var (
 	care     = watch.Globs{NoDefault: false, Default: nil, Additional: nil}
 	loglevel = LogLevelInfo
 
-	interval = flag.Duration("interval", 300*time.Millisecond, "interval to wait between monitoring")
-	monitor  = flag.String("monitor", ".", "files/folders/globs to monitor")
-	recurse  = flag.Bool("recurse", true, "when watching a folder should recurse")
-	verbose  = flag.Bool("verbose", false, "verbose output (same as -log=debug)")
-	clear    = flag.Bool("clear", false, "clear the screen after rerunning the commands")
+	interval  = flag.Duration("interval", 300*time.Millisecond, "interval to wait between monitoring")
+	maxpoll   = flag.Duration("max-interval", 0, "lengthen the interval up to this long while nothing changes or scanning is slow")
+	quiet     = flag.Duration("quiet", 0, "how long files must stay unchanged before rerunning (default -interval)")
+	maxwait   = flag.Duration("max-wait", 0, "rerun even when files keep changing for this long, negative disables (default 10*-quiet)")
+	stable    = flag.Duration("wait-stable", 0, "hold back files that are still changing between scans for at most this long")
+	monitor   = flag.String("monitor", ".", "files/folders/globs to monitor")
+	recurse   = flag.Bool("recurse", true, "when watching a folder should recurse")
+	cachedirs = flag.Bool("incremental", false, "list only the folders with inotify events again")
+	workers   = flag.Int("concurrency", 1, "how many folders to list at the same time")
+	follow    = flag.Bool("follow-symlinks", false, "scan the targets of symbolic links")
+	dirs      = flag.Bool("dirs", false, "also rerun when folders are created or deleted")
+	attrs     = flag.Bool("attributes", false, "also rerun when the size, mode, inode or change time of a file differs")
+	semantic  = flag.Bool("go-semantic", false, "do not rerun when .go files change only in comments or formatting")
+	hash      = flag.Bool("hash", false, "compare file contents to skip changes where only the modification time changed")
+	gitignore = flag.Bool("gitignore", false, "ignore files listed in .gitignore, .git/info/exclude and .watchrunignore")
+	statefile = flag.String("state", "", "save the monitored files to this file on exit and rerun on start only for changes since then")
+	skipsame  = flag.Bool("skip-unchanged", false, "with -state, do not run the commands on start when nothing changed")
+	verbose   = flag.Bool("verbose", false, "verbose output (same as -log=debug)")
+	clear     = flag.Bool("clear", false, "clear the screen after rerunning the commands")
 )
 
 func init() {
@@ -51,37 +67,84 @@ func main() {
 
 	if loglevel.Matches(LogLevelDebug) {
 		fmt.Println("Options:")
-		fmt.Println("    interval   : ", *interval)
+		fmt.Println("    interval   : ", *interval, "max-interval:", *maxpoll)
+		fmt.Println("    quiet      : ", *quiet)
+		fmt.Println("    max-wait   : ", *maxwait)
+		fmt.Println("    wait-stable: ", *stable)
 		fmt.Println("    recursive  : ", *recurse)
 		fmt.Println("    monitoring : ", monitoring)
 		fmt.Println("    ignoring   : ", ignoring)
 		fmt.Println("    caring     : ", caring)
+		fmt.Println("    incremental: ", *cachedirs)
+		fmt.Println("    concurrency: ", *workers)
+		fmt.Println("    follow     : ", *follow)
+		fmt.Println("    dirs       : ", *dirs)
+		fmt.Println("    hash       : ", *hash)
+		fmt.Println("    attributes : ", *attrs)
+		fmt.Println("    go-semantic: ", *semantic)
+		fmt.Println("    gitignore  : ", *gitignore)
+		fmt.Println("    state      : ", *statefile, "skip-unchanged:", *skipsame)
 		fmt.Println()
 
 		fmt.Println("Processes:")
 		for _, proc := range procs {
+			if proc.Parallel {
+				fmt.Printf("    ++ %s %s\n", proc.Cmd, strings.Join(proc.Args, " "))
+				continue
+			}
 			fmt.Printf("    %s %s\n", proc.Cmd, strings.Join(proc.Args, " "))
 		}
 		fmt.Println()
 	}
 
-	watcher := watch.New(
-		*interval,
-		monitoring,
-		ignoring,
-		caring,
-		*recurse,
-	)
-
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-sigs
-		watcher.Stop()
-	}()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	watcher, err := watch.NewContext(ctx, watch.Config{
+		Interval:  *interval,
+		Quiet:     *quiet,
+		MaxWait:   *maxwait,
+		Monitor:   monitoring,
+		Ignore:    ignoring,
+		Care:      caring,
+		Recurse:   *recurse,
+		Dirs:      *dirs,
+		Hash:      *hash,
+		GitIgnore: *gitignore,
+
+		MaxInterval:    *maxpoll,
+		WaitStable:     *stable,
+		Attributes:     *attrs,
+		FollowSymlinks: *follow,
+		Incremental:    *cachedirs,
+		Concurrency:    *workers,
+		StateFile:      *statefile,
+		SkipUnchanged:  *skipsame,
+
+		OnError: func(err error) {
+			logln(LogLevelWarn, "<< warn:", err, ">>")
+		},
+		OnStats: scanStats(),
+	})
+	if err != nil {
+		logln(LogLevelError, err)
+		os.Exit(1)
+	}
+
+	var syntax *watch.GoSemantic
+	if *semantic {
+		syntax = watch.NewGoSemantic(nil)
+	}
 
 	var pipe *pipeline.Pipeline
-	for range watcher.Changes {
+	for changes := range watcher.Changes {
+		if syntax != nil && len(changes) > 0 {
+			if len(syntax.Filter(changes)) == 0 {
+				logln(LogLevelDebug, "<< only comments or formatting changed >>")
+				continue
+			}
+		}
+
 		if pipe != nil {
 			pipe.Kill()
 		}
@@ -96,3 +159,33 @@ func main() {
 		pipe.Kill()
 	}
 }
+
+// scanStats returns a func that prints the scan statistics and warns
+// when scanning starts to take longer than the interval.
+func scanStats() func(stats watch.Stats) {
+	slow := false
+	return func(stats watch.Stats) {
+		logf(LogLevelDebug, "<< scanned %d files in %d dirs (%d entries) in %v >>\n",
+			stats.Files, stats.Dirs, stats.Entries, stats.Duration)
+		reasons := make([]string, 0, len(stats.Ignored))
+		for reason := range stats.Ignored {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			logf(LogLevelDebug, "    ignored %-20s: %d\n", reason, stats.Ignored[reason])
+		}
+
+		wasSlow := slow
+		slow = stats.Duration > *interval
+		if !slow || wasSlow {
+			return
+		}
+		largest := make([]string, 0, len(stats.Largest))
+		for _, dir := range stats.Largest {
+			largest = append(largest, fmt.Sprintf("%s (%d)", dir.Path, dir.Entries))
+		}
+		logln(LogLevelWarn, "<< warn: scanning took", stats.Duration, "which is longer than -interval", *interval,
+			"largest directories:", strings.Join(largest, ", "), ">>")
+	}
+}
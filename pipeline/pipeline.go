@@ -24,6 +24,8 @@ type Log interface {
 type Process struct {
 	Cmd  string
 	Args []string
+	// Parallel runs the process in the same stage as the previous one.
+	Parallel bool
 }
 
 func (proc *Process) String() string {
@@ -37,11 +39,12 @@ type Pipeline struct {
 	Processes []Process
 
 	mu     sync.Mutex
-	proc   Process
 	reader io.ReadCloser
 	writer io.WriteCloser
-	active *exec.Cmd
+	active map[*exec.Cmd]Process
 	killed bool
+	// started is called with every started process, for tests
+	started func(cmd *exec.Cmd)
 }
 
 func (pipe *Pipeline) closeio() {
@@ -69,51 +72,125 @@ func (pipe *Pipeline) Run() {
 		<-copied
 	}()
 
-	for _, proc := range pipe.Processes {
-		pipe.mu.Lock()
-		if pipe.killed {
-			pipe.mu.Unlock()
+	for _, stage := range stages(pipe.Processes) {
+		if !pipe.runStage(stage) {
 			return
 		}
+	}
+}
+
+// stages groups the processes that run concurrently.
+func stages(procs []Process) [][]Process {
+	var stages [][]Process
+	for _, proc := range procs {
+		if proc.Parallel && len(stages) > 0 {
+			stages[len(stages)-1] = append(stages[len(stages)-1], proc)
+			continue
+		}
+		stages = append(stages, []Process{proc})
+	}
+	return stages
+}
+
+// runStage runs the processes of a stage concurrently and reports
+// whether all of them succeeded. The first failure kills the others.
+func (pipe *Pipeline) runStage(stage []Process) bool {
+	pipe.mu.Lock()
+	if pipe.killed {
+		pipe.mu.Unlock()
+		return false
+	}
+	if pipe.active == nil {
+		pipe.active = make(map[*exec.Cmd]Process)
+	}
 
-		pipe.proc = proc
-		pipe.active = exec.Command(proc.Cmd, proc.Args...)
-		pipe.active.Dir = pipe.Dir
-		pgroup.Setup(pipe.active)
+	start := hrtime.Now()
+	cmds := make([]*exec.Cmd, 0, len(stage))
+	for _, proc := range stage {
+		cmd := exec.Command(proc.Cmd, proc.Args...)
+		cmd.Dir = pipe.Dir
+		pgroup.Setup(cmd)
 
-		pipe.active.Stdout, pipe.active.Stderr = pipe.writer, pipe.writer
+		cmd.Stdout, cmd.Stderr = pipe.writer, pipe.writer
 
 		pipe.Log.Info("<<  run:", proc.String(), ">>")
 
-		start := hrtime.Now()
-		err := pipe.active.Start()
+		err := cmd.Start()
 		if err != nil {
-			pipe.active = nil
+			pipe.killActive()
 			pipe.killed = true
 			pipe.closeio()
 			pipe.mu.Unlock()
 			pipe.Log.Error("<< fail:", err, ">>")
-			return
+			// release the members that were already started
+			for _, started := range cmds {
+				_ = started.Wait()
+			}
+			return false
 		}
-		cmd := pipe.active
-		pipe.mu.Unlock()
+		pipe.active[cmd] = proc
+		cmds = append(cmds, cmd)
+		if pipe.started != nil {
+			pipe.started(cmd)
+		}
+	}
+	pipe.mu.Unlock()
 
-		if err := cmd.Wait(); err != nil {
-			return
+	type result struct {
+		proc Process
+		err  error
+	}
+	results := make(chan result, len(cmds))
+	for i, cmd := range cmds {
+		go func() {
+			proc := stage[i]
+			err := cmd.Wait()
+
+			pipe.mu.Lock()
+			delete(pipe.active, cmd)
+			pipe.mu.Unlock()
+
+			if err == nil {
+				pipe.Log.Info("<< done:", proc.String(), hrtime.Since(start), ">>")
+			}
+			results <- result{proc, err}
+		}()
+	}
+
+	ok := true
+	for range cmds {
+		result := <-results
+		if result.err == nil || !ok {
+			continue
 		}
-		pipe.Log.Info("<< done:", proc.String(), hrtime.Since(start), ">>")
+		ok = false
+		if len(stage) > 1 {
+			pipe.Log.Error("<< fail:", result.proc.String(), result.err, ">>")
+			pipe.mu.Lock()
+			pipe.killActive()
+			pipe.mu.Unlock()
+		}
+	}
+	return ok
+}
+
+// killActive kills the running processes, pipe.mu must be held.
+func (pipe *Pipeline) killActive() {
+	for cmd, proc := range pipe.active {
+		pipe.Log.Info("<< kill:", proc.String(), ">>")
+		pgroup.Kill(cmd)
 	}
+	clear(pipe.active)
 }
 
+// Kill stops the pipeline and kills all of its running processes.
 func (pipe *Pipeline) Kill() {
 	pipe.mu.Lock()
 	defer pipe.mu.Unlock()
 
-	if pipe.active != nil {
-		pipe.Log.Info("<< kill:", pipe.proc.String(), ">>")
+	if len(pipe.active) > 0 {
 		pipe.closeio()
-		pgroup.Kill(pipe.active)
-		pipe.active = nil
+		pipe.killActive()
 	}
 	pipe.killed = true
 }
@@ -182,6 +259,9 @@ func tokenize(s string) ([]string, error) {
 }
 
 func ParseArgs(args []string) (procs []Process) {
+	// "==" and ";;" separate stages that run one after another,
+	// "++" separates processes that run concurrently in a stage
+
 	// support passing the whole pipeline as a single quoted argument,
 	// since unquoted ";;" and "==" are mangled by shells
 	if len(args) == 1 {
@@ -191,29 +271,40 @@ func ParseArgs(args []string) (procs []Process) {
 		}
 		// ponytail: a quoted "==" still acts as a separator;
 		// track quoting in tokenize if that ever matters
-		if slices.Contains(fields, ";;") || slices.Contains(fields, "==") {
+		if slices.ContainsFunc(fields, isSeparator) {
 			args = fields
 		}
 	}
 
 	start := 0
+	// parallel is whether only "++" separates the next process from the previous
+	parallel := false
+	add := func(args []string) {
+		procs = append(procs, Process{
+			Cmd:      args[0],
+			Args:     args[1:],
+			Parallel: parallel && len(procs) > 0,
+		})
+		parallel = true
+	}
 	for i, arg := range args {
-		if arg == ";;" || arg == "==" {
+		if isSeparator(arg) {
 			if i > start {
-				procs = append(procs, Process{
-					Cmd:  args[start],
-					Args: args[start+1 : i],
-				})
+				add(args[start:i])
+			}
+			if arg != "++" {
+				parallel = false
 			}
 			start = i + 1
 		}
 	}
 	if start < len(args) {
-		procs = append(procs, Process{
-			Cmd:  args[start],
-			Args: args[start+1:],
-		})
+		add(args[start:])
 	}
 
 	return procs
 }
+
+func isSeparator(arg string) bool {
+	return arg == ";;" || arg == "==" || arg == "++"
+}
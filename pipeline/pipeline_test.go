@@ -2,10 +2,13 @@ package pipeline
 
 import (
 	"bytes"
+	"io"
+	"os/exec"
 	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 type nopLog struct{}
@@ -61,25 +64,135 @@ func TestRunFlushesOutput(t *testing.T) {
 	}
 }
 
+func TestRunStage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh binary on windows")
+	}
+	sh := func(script string, parallel bool) Process {
+		return Process{Cmd: "sh", Args: []string{"-c", script}, Parallel: parallel}
+	}
+
+	var buf bytes.Buffer
+	pipe := &Pipeline{
+		Output: &buf,
+		Log:    nopLog{},
+		Processes: []Process{
+			sh("sleep 0.2; echo slow", false),
+			sh("echo fast", true),
+			sh("echo next", false),
+		},
+	}
+	pipe.Run()
+	if got, exp := strings.Fields(buf.String()), []string{"fast", "slow", "next"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got output %q, expected %q", got, exp)
+	}
+
+	buf.Reset()
+	pipe = &Pipeline{
+		Output: &buf,
+		Log:    nopLog{},
+		Processes: []Process{
+			sh("sleep 10", false),
+			sh("exit 1", true),
+			sh("echo next", false),
+		},
+	}
+	start := time.Now()
+	pipe.Run()
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("failing member did not kill the stage, took %v", took)
+	}
+	if strings.Contains(buf.String(), "next") {
+		t.Errorf("the stage after a failure ran: %q", buf.String())
+	}
+}
+
+func TestKillStage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep binary on windows")
+	}
+	pipe := &Pipeline{
+		Output: io.Discard,
+		Log:    nopLog{},
+		Processes: []Process{
+			{Cmd: "sleep", Args: []string{"10"}},
+			{Cmd: "sleep", Args: []string{"10"}, Parallel: true},
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pipe.Run()
+	}()
+	for {
+		pipe.mu.Lock()
+		started := len(pipe.active) == 2
+		pipe.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	pipe.Kill()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Kill did not stop all members of the stage")
+	}
+}
+
+func TestStartFailureReleasesStage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep binary on windows")
+	}
+	var started []*exec.Cmd
+	pipe := &Pipeline{
+		Output: io.Discard,
+		Log:    nopLog{},
+		Processes: []Process{
+			{Cmd: "sleep", Args: []string{"10"}},
+			{Cmd: "./does-not-exist", Parallel: true},
+		},
+		started: func(cmd *exec.Cmd) { started = append(started, cmd) },
+	}
+	pipe.Run()
+
+	if len(started) != 1 {
+		t.Fatalf("got %d started processes, expected 1", len(started))
+	}
+	// the killed member must have been waited for, instead of being left as a zombie
+	if started[0].ProcessState == nil {
+		t.Error("the started member was not waited for")
+	}
+}
+
 func TestParseArgs(t *testing.T) {
 	tests := []struct {
 		args []string
 		exp  []Process
 	}{
-		{[]string{"echo", "hi"}, []Process{{"echo", []string{"hi"}}}},
-		{[]string{"a", ";;", "b", "x"}, []Process{{"a", []string{}}, {"b", []string{"x"}}}},
-		{[]string{";;", "b"}, []Process{{"b", []string{}}}},
-		{[]string{"a", ";;", ";;", "b"}, []Process{{"a", []string{}}, {"b", []string{}}}},
-		{[]string{"a", ";;"}, []Process{{"a", []string{}}}},
+		{[]string{"echo", "hi"}, []Process{{"echo", []string{"hi"}, false}}},
+		{[]string{"a", ";;", "b", "x"}, []Process{{"a", []string{}, false}, {"b", []string{"x"}, false}}},
+		{[]string{";;", "b"}, []Process{{"b", []string{}, false}}},
+		{[]string{"a", ";;", ";;", "b"}, []Process{{"a", []string{}, false}, {"b", []string{}, false}}},
+		{[]string{"a", ";;"}, []Process{{"a", []string{}, false}}},
 		// whole pipeline as a single quoted argument
 		{[]string{"go build -o example.exe . == ./example.exe"},
-			[]Process{{"go", []string{"build", "-o", "example.exe", "."}}, {"./example.exe", []string{}}}},
-		{[]string{"a x ;; b"}, []Process{{"a", []string{"x"}}, {"b", []string{}}}},
+			[]Process{{"go", []string{"build", "-o", "example.exe", "."}, false}, {"./example.exe", []string{}, false}}},
+		{[]string{"a x ;; b"}, []Process{{"a", []string{"x"}, false}, {"b", []string{}, false}}},
 		// quoting inside a single-argument pipeline
 		{[]string{`cmd 'two words' == other "a b"`},
-			[]Process{{"cmd", []string{"two words"}}, {"other", []string{"a b"}}}},
+			[]Process{{"cmd", []string{"two words"}, false}, {"other", []string{"a b"}, false}}},
 		// single argument without separators stays a single command
-		{[]string{"/path with spaces/cmd"}, []Process{{"/path with spaces/cmd", []string{}}}},
+		{[]string{"/path with spaces/cmd"}, []Process{{"/path with spaces/cmd", []string{}, false}}},
+		// concurrent stages
+		{[]string{"a", "++", "b", "x", "==", "c"},
+			[]Process{{"a", []string{}, false}, {"b", []string{"x"}, true}, {"c", []string{}, false}}},
+		{[]string{"npm run build ++ go build . == ./server"},
+			[]Process{{"npm", []string{"run", "build"}, false}, {"go", []string{"build", "."}, true}, {"./server", []string{}, false}}},
+		{[]string{"++", "a", "++", "++", "b"}, []Process{{"a", []string{}, false}, {"b", []string{}, true}}},
+		{[]string{"a", "++", "==", "b"}, []Process{{"a", []string{}, false}, {"b", []string{}, false}}},
 	}
 	for _, test := range tests {
 		got := ParseArgs(test.args)
@@ -0,0 +1,20 @@
+package watch
+
+import "time"
+
+// adapt updates the polling interval after a scan that took the
+// given time, when MaxInterval enables adaptive polling.
+func (watch *Watch) adapt(changed bool, took time.Duration) {
+	lo, hi := watch.config.Interval, watch.config.MaxInterval
+	if hi <= lo {
+		return
+	}
+
+	next := 2 * watch.interval
+	if changed {
+		next = lo
+	}
+	// spend at most half of the time scanning
+	next = max(next, 2*took)
+	watch.interval = min(max(next, lo), hi)
+}
@@ -0,0 +1,16 @@
+package watch
+
+import "time"
+
+// Clock tells the time and waits for it to pass. Tests can use a fake
+// clock, such as watchtest.Clock, to step time forward deterministically.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the real time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
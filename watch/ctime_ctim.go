@@ -0,0 +1,18 @@
+//go:build linux || openbsd
+
+package watch
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// changeTimeOf returns the time the file metadata last changed.
+func changeTimeOf(f os.FileInfo) time.Time {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(stat.Ctim.Unix())
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !openbsd && !darwin && !freebsd && !netbsd
+
+package watch
+
+import (
+	"os"
+	"time"
+)
+
+// changeTimeOf returns the zero time, since there is no change time.
+func changeTimeOf(f os.FileInfo) time.Time { return time.Time{} }
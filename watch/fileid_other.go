@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !netbsd && !freebsd && !openbsd
+
+package watch
+
+import "os"
+
+// fileIDOf returns the zero fileID, since there is no inode to identify files.
+func fileIDOf(f os.FileInfo) fileID { return fileID{} }
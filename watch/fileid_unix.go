@@ -0,0 +1,17 @@
+//go:build linux || darwin || netbsd || freebsd || openbsd
+
+package watch
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIDOf returns the device and inode of a file.
+func fileIDOf(f os.FileInfo) fileID {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}
+	}
+	return fileID{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}
+}
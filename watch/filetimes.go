@@ -0,0 +1,227 @@
+package watch
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// filetimes is the state of the monitored files.
+type filetimes map[string]entry
+
+// entry is the state of a single file or directory.
+type entry struct {
+	Dir      bool
+	Modified time.Time
+	Size     int64
+	// ID identifies the file across renames, when the platform supports it.
+	ID fileID
+	// Hash of the content, when hashing is enabled.
+	Hash hash
+
+	// Attributes enables comparing Size, ID, Mode and ChangeTime.
+	Attributes bool
+	Mode       os.FileMode
+	ChangeTime time.Time
+}
+
+// fileID is the device and inode of a file.
+type fileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+// IsZero reports whether the id is missing.
+func (id fileID) IsZero() bool { return id == fileID{} }
+
+// same reports whether the file is unchanged.
+// Directories only change by being created or deleted.
+func (a entry) same(b entry) bool {
+	if a.Dir || b.Dir {
+		return a.Dir == b.Dir
+	}
+	return a.diff(b) == 0
+}
+
+// diff returns the attributes of a file that differ.
+func (a entry) diff(b entry) Attrs {
+	var attrs Attrs
+	if !a.Hash.IsZero() && !b.Hash.IsZero() {
+		if a.Hash != b.Hash {
+			attrs |= AttrContent
+		}
+	} else if !a.Modified.Equal(b.Modified) {
+		attrs |= AttrModTime
+	}
+
+	if a.Attributes && b.Attributes {
+		if a.Size != b.Size {
+			attrs |= AttrSize
+		}
+		if a.Mode != b.Mode {
+			attrs |= AttrMode
+		}
+		if a.ID != b.ID {
+			attrs |= AttrInode
+		}
+		if !a.ChangeTime.Equal(b.ChangeTime) {
+			attrs |= AttrChangeTime
+		}
+	}
+	return attrs
+}
+
+// Attrs is a set of file attributes.
+type Attrs uint8
+
+const (
+	AttrContent Attrs = 1 << iota
+	AttrModTime
+	AttrSize
+	AttrMode
+	AttrInode
+	AttrChangeTime
+)
+
+var attrNames = []string{"content", "mtime", "size", "mode", "inode", "ctime"}
+
+// Has reports whether all of the attributes in b are set.
+func (attrs Attrs) Has(b Attrs) bool { return attrs&b == b }
+
+// String returns the attribute names separated by "|".
+func (attrs Attrs) String() string {
+	var names []string
+	for i, name := range attrNames {
+		if attrs&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Change describes a created, modified, deleted or renamed file.
+type Change struct {
+	// Kind is one of "create", "modify", "delete" or "rename".
+	Kind     string
+	Path     string
+	Modified time.Time
+	// OldPath is the previous path of a renamed file.
+	OldPath string
+	// Dir is set for changes to directories, see Config.Dirs.
+	Dir bool
+	// Attributes that differ for a "modify" of a file: AttrContent or
+	// AttrModTime, and with Config.Attributes also AttrSize, AttrMode,
+	// AttrInode and AttrChangeTime.
+	Attributes Attrs
+}
+
+func (current filetimes) Changes(next filetimes) (changes []Change) {
+	// modified and deleted files
+	for file, info := range current {
+		ninfo, nok := next[file]
+		if !nok {
+			changes = append(changes, Change{Kind: "delete", Path: file, Modified: info.Modified, Dir: info.Dir})
+			continue
+		}
+		if !ninfo.same(info) {
+			changes = append(changes, Change{Kind: "modify", Path: file, Modified: ninfo.Modified, Dir: ninfo.Dir, Attributes: info.diff(ninfo)})
+			continue
+		}
+	}
+	// added files
+	for file, ninfo := range next {
+		if _, ok := current[file]; !ok {
+			changes = append(changes, Change{Kind: "create", Path: file, Modified: ninfo.Modified, Dir: ninfo.Dir})
+			continue
+		}
+	}
+	return
+}
+
+// Renames returns the changes between current and next,
+// reporting a deleted and a created file with the same
+// identity as a rename.
+//
+// Files are matched by device and inode together with size and
+// modification time, which a rename keeps but a new file reusing
+// the inode does not. Otherwise they are matched by size and
+// content hash when those are available.
+func (current filetimes) Renames(next filetimes) []Change {
+	changes := current.Changes(next)
+
+	type content struct {
+		size int64
+		hash hash
+	}
+	byID := map[fileID]int{}
+	byContent := map[content][]int{}
+	for i, change := range changes {
+		if change.Kind != "delete" {
+			continue
+		}
+		info := current[change.Path]
+		if !info.ID.IsZero() {
+			byID[info.ID] = i
+		}
+		if !info.Hash.IsZero() {
+			key := content{info.Size, info.Hash}
+			byContent[key] = append(byContent[key], i)
+		}
+	}
+	if len(byID) == 0 && len(byContent) == 0 {
+		return changes
+	}
+
+	renamed := map[int]bool{}
+	match := func(info entry) (int, bool) {
+		if deleted, ok := byID[info.ID]; ok && !info.ID.IsZero() && !renamed[deleted] {
+			old := current[changes[deleted].Path]
+			if old.Size == info.Size && old.Modified.Equal(info.Modified) {
+				return deleted, true
+			}
+		}
+		if info.Hash.IsZero() {
+			return 0, false
+		}
+		for _, deleted := range byContent[content{info.Size, info.Hash}] {
+			if !renamed[deleted] {
+				return deleted, true
+			}
+		}
+		return 0, false
+	}
+
+	for i, change := range changes {
+		if change.Kind != "create" {
+			continue
+		}
+		deleted, ok := match(next[change.Path])
+		if !ok {
+			continue
+		}
+		changes[i].Kind = "rename"
+		changes[i].OldPath = changes[deleted].Path
+		renamed[deleted] = true
+	}
+
+	kept := changes[:0]
+	for i, change := range changes {
+		if !renamed[i] {
+			kept = append(kept, change)
+		}
+	}
+	return kept
+}
+
+func (a filetimes) Same(b filetimes) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, info := range a {
+		ninfo, ok := b[file]
+		if !ok || !ninfo.same(info) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestChangesHash(t *testing.T) {
+	dir := createTree(t, "main.go")
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte("package main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var previous filetimes
+	rescan := func() filetimes {
+		scan := newScanner(Config{Recurse: true, Hash: true})
+		scan.previous = previous
+		if err := scan.IncludeGlob(dir); err != nil {
+			t.Fatal(err)
+		}
+		return scan.times
+	}
+	previous = rescan()
+
+	// touching the file does not change the content
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, future, future); err != nil {
+		t.Fatal(err)
+	}
+	next := rescan()
+	if changes := previous.Changes(next); len(changes) != 0 || !previous.Same(next) {
+		t.Errorf("touch: got %v, expected no changes", changes)
+	}
+	previous = next
+
+	// rewriting the same bytes does not change the content
+	if err := os.WriteFile(file, []byte("package main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	next = rescan()
+	if changes := previous.Changes(next); len(changes) != 0 {
+		t.Errorf("rewrite: got %v, expected no changes", changes)
+	}
+	previous = next
+
+	if err := os.WriteFile(file, []byte("package server"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	next = rescan()
+	changes := previous.Changes(next)
+	if len(changes) != 1 || changes[0].Kind != "modify" {
+		t.Errorf("edit: got %v, expected a modify", changes)
+	}
+}
+
+func TestRenames(t *testing.T) {
+	at := time.Now()
+	current := filetimes{
+		"a.css":   {Modified: at, Size: 1, ID: fileID{1, 10}},
+		"b.css":   {Modified: at, Size: 2, ID: fileID{1, 11}},
+		"c.js":    {Modified: at, Size: 3, Hash: hash{3}},
+		"keep.js": {Modified: at, Size: 4, ID: fileID{1, 13}},
+		"old.go":  {Modified: at, Size: 5, ID: fileID{1, 14}},
+	}
+	// new.go reuses the inode of the deleted old.go
+	next := filetimes{
+		"static/a.css": {Modified: at, Size: 1, ID: fileID{1, 10}},
+		"d.css":        {Modified: at, Size: 2, ID: fileID{1, 20}},
+		"lib/c.js":     {Modified: at, Size: 3, Hash: hash{3}},
+		"keep.js":      {Modified: at, Size: 4, ID: fileID{1, 13}},
+		"new.go":       {Modified: at.Add(time.Second), Size: 6, ID: fileID{1, 14}},
+	}
+
+	got := map[string]Change{}
+	for _, change := range current.Renames(next) {
+		got[change.Path] = change
+	}
+	exp := map[string]Change{
+		"static/a.css": {Kind: "rename", Path: "static/a.css", OldPath: "a.css", Modified: at},
+		"lib/c.js":     {Kind: "rename", Path: "lib/c.js", OldPath: "c.js", Modified: at},
+		"b.css":        {Kind: "delete", Path: "b.css", Modified: at},
+		"d.css":        {Kind: "create", Path: "d.css", Modified: at},
+		"old.go":       {Kind: "delete", Path: "old.go", Modified: at},
+		"new.go":       {Kind: "create", Path: "new.go", Modified: at.Add(time.Second)},
+	}
+	if len(got) != len(exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+	for path, change := range exp {
+		if got[path] != change {
+			t.Errorf("%s: got %+v, expected %+v", path, got[path], change)
+		}
+	}
+}
+
+func TestDirs(t *testing.T) {
+	dir := createTree(t, "main.go", "logs/debug.log")
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	rescan := func() filetimes {
+		scan := newScanner(Config{Ignore: DefaultIgnore, Recurse: true, Dirs: true})
+		if err := scan.IncludeGlob(dir); err != nil {
+			t.Fatal(err)
+		}
+		return scan.times
+	}
+
+	previous := rescan()
+	for _, name := range []string{"empty", "logs"} {
+		if info, ok := previous[filepath.Join(dir, name)]; !ok || !info.Dir {
+			t.Errorf("%s: got %+v, expected a directory", name, info)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, "empty")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "created"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]Change{}
+	for _, change := range previous.Changes(rescan()) {
+		rel, _ := filepath.Rel(dir, change.Path)
+		got[rel] = change
+	}
+	if len(got) != 2 ||
+		got["empty"].Kind != "delete" || !got["empty"].Dir ||
+		got["created"].Kind != "create" || !got["created"].Dir {
+		t.Errorf("got %+v, expected empty deleted and created created", got)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no change time or permission bits")
+	}
+	dir := createTree(t, "main.go")
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte("package main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(file, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	rescan := func(attributes bool) filetimes {
+		scan := newScanner(Config{Recurse: true, Attributes: attributes})
+		if err := scan.IncludeGlob(dir); err != nil {
+			t.Fatal(err)
+		}
+		return scan.times
+	}
+	plain, strict := rescan(false), rescan(true)
+
+	// same size, restored modification time and different permissions
+	if err := os.WriteFile(file, []byte("package util"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	if changes := plain.Changes(rescan(false)); len(changes) != 0 {
+		t.Errorf("without attributes: got %v, expected no changes", changes)
+	}
+	changes := strict.Changes(rescan(true))
+	if len(changes) != 1 {
+		t.Fatalf("with attributes: got %v, expected a change", changes)
+	}
+	attrs := changes[0].Attributes
+	if !attrs.Has(AttrMode|AttrChangeTime) || attrs.Has(AttrModTime) || attrs.Has(AttrSize) {
+		t.Errorf("got attributes %v, expected mode|ctime", attrs)
+	}
+}
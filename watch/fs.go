@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// filesystem is what the scanner needs from the files it scans.
+// Names use the operating system separator.
+type filesystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	// ReadDir returns the entries of a directory sorted by name.
+	ReadDir(name string) ([]fs.FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+
+	// Abs returns an absolute name, used to find
+	// the repository that contains the name.
+	Abs(name string) (string, error)
+	// EvalSymlinks returns the name without symbolic links.
+	EvalSymlinks(name string) (string, error)
+}
+
+// newFilesystem returns the files to scan, the disk when fsys is nil.
+func newFilesystem(fsys fs.FS) filesystem {
+	if fsys == nil {
+		return osFS{}
+	}
+	return ioFS{fsys}
+}
+
+// osFS is the disk.
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)   { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)  { return os.Lstat(name) }
+func (osFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+func (osFS) Abs(name string) (string, error)         { return filepath.Abs(name) }
+
+func (osFS) ReadDir(name string) ([]fs.FileInfo, error) { return ioutil.ReadDir(name) }
+func (osFS) EvalSymlinks(name string) (string, error)   { return filepath.EvalSymlinks(name) }
+
+// readFile returns the content of the named file.
+func readFile(fsys filesystem, name string) ([]byte, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// ioFS is an fs.FS, such as an embedded or in-memory tree.
+type ioFS struct{ fsys fs.FS }
+
+// name converts a name to the slash separated form that fs.FS uses.
+func (ioFS) name(name string) string { return filepath.ToSlash(name) }
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error)   { return fs.Stat(f.fsys, f.name(name)) }
+func (f ioFS) Lstat(name string) (fs.FileInfo, error)  { return fs.Lstat(f.fsys, f.name(name)) }
+func (f ioFS) Open(name string) (io.ReadCloser, error) { return f.fsys.Open(f.name(name)) }
+
+// Abs returns the name unchanged, since there is nothing outside the fs.FS.
+func (ioFS) Abs(name string) (string, error) { return filepath.Clean(name), nil }
+
+func (f ioFS) ReadDir(name string) ([]fs.FileInfo, error) {
+	dirents, err := fs.ReadDir(f.fsys, f.name(name))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.FileInfo, 0, len(dirents))
+	for _, dirent := range dirents {
+		info, err := dirent.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
+
+// maxLinks is how many symbolic links are followed when resolving a name.
+const maxLinks = 255
+
+// EvalSymlinks resolves the symbolic links in name one element at a time.
+func (f ioFS) EvalSymlinks(name string) (string, error) {
+	rest := strings.Split(f.name(name), "/")
+	resolved := "."
+	for links := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+		if elem == "" || elem == "." {
+			continue
+		}
+
+		next := path.Join(resolved, elem)
+		info, err := fs.Lstat(f.fsys, next)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxLinks {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: errors.New("too many links")}
+		}
+		target, err := fs.ReadLink(f.fsys, next)
+		if err != nil {
+			return "", err
+		}
+		rest = append(strings.Split(path.Join(resolved, target), "/"), rest...)
+		resolved = "."
+	}
+	return filepath.FromSlash(resolved), nil
+}
@@ -0,0 +1,118 @@
+package watch
+
+import (
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// scanFS scans the monitored globs in fsys and returns the result.
+func scanFS(t *testing.T, config Config, previous filetimes) filetimes {
+	t.Helper()
+	scan := newScanner(config)
+	scan.previous = previous
+	for _, glob := range config.Monitor {
+		if err := scan.IncludeGlob(glob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return scan.times
+}
+
+func TestScanFS(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"main.go":            {Data: []byte("package main"), ModTime: at},
+		"build.log":          {ModTime: at},
+		".gitignore":         {Data: []byte("generated/\n"), ModTime: at},
+		"cmd/server/main.go": {ModTime: at},
+		"generated/api.go":   {ModTime: at},
+		"web/app.js":         {ModTime: at},
+	}
+
+	config := Config{
+		FS:        fsys,
+		Monitor:   []string{"."},
+		Ignore:    DefaultIgnore,
+		Recurse:   true,
+		GitIgnore: true,
+		Hash:      true,
+	}
+	previous := scanFS(t, config, nil)
+	var got []string
+	for file := range previous {
+		got = append(got, file)
+	}
+	sort.Strings(got)
+	exp := []string{"cmd/server/main.go", "main.go", "web/app.js"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, expected %v", got, exp)
+	}
+
+	fsys["main.go"] = &fstest.MapFile{Data: []byte("package server"), ModTime: at}
+	fsys["web/app.css"] = &fstest.MapFile{ModTime: at}
+	delete(fsys, "cmd/server/main.go")
+	fsys["generated/types.go"] = &fstest.MapFile{ModTime: at}
+
+	next := scanFS(t, config, previous)
+	var changes []string
+	for _, change := range previous.Changes(next) {
+		changes = append(changes, change.Kind+" "+change.Path)
+	}
+	sort.Strings(changes)
+	exp = []string{"create web/app.css", "delete cmd/server/main.go", "modify main.go"}
+	if !reflect.DeepEqual(changes, exp) {
+		t.Errorf("got %v, expected %v", changes, exp)
+	}
+}
+
+func TestScanFSSymlinks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":       {},
+		"shared/lib.go": {},
+		"lib.go":        {Data: []byte("shared/lib.go"), Mode: fs.ModeSymlink},
+		"vendor":        {Data: []byte("shared"), Mode: fs.ModeSymlink},
+		"shared/loop":   {Data: []byte(".."), Mode: fs.ModeSymlink},
+	}
+
+	// vendor is scanned like shared, loop leads back to a folder being scanned
+	times := scanFS(t, Config{FS: fsys, Monitor: []string{"."}, Recurse: true, FollowSymlinks: true}, nil)
+	var got []string
+	for file := range times {
+		got = append(got, file)
+	}
+	sort.Strings(got)
+	exp := []string{"lib.go", "main.go", "shared/lib.go", "vendor/lib.go"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestWatchFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":  {},
+		"index.md": {},
+	}
+	watch, err := Start(Config{
+		FS:       fsys,
+		Interval: time.Millisecond,
+		Care:     []string{"*.go"},
+		Recurse:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		watch.Stop()
+		for range watch.Changes {
+		}
+	}()
+
+	changes := <-watch.Changes
+	if len(changes) != 1 || changes[0].Kind != "create" || changes[0].Path != "main.go" {
+		t.Errorf("got %v, expected main.go to be created", changes)
+	}
+}
@@ -0,0 +1,142 @@
+package watch
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ignoreList is a chain of loaded ignore files, innermost first.
+type ignoreList struct {
+	parent *ignoreList
+
+	// dir is the folder containing the ignore file, in the same form as
+	// the scanned paths; when the file is in a parent of the monitored
+	// folder, dir is the monitored folder and sub is its path relative
+	// to the folder containing the file.
+	dir   string
+	sub   string
+	rules []rule
+}
+
+// Ignored reports whether path is ignored by any of the files.
+// Deeper files take precedence and within a file the last
+// matching rule wins.
+func (list *ignoreList) Ignored(path, base string, isDir bool) bool {
+	for ; list != nil; list = list.parent {
+		rel := list.rel(path)
+		for i := len(list.rules) - 1; i >= 0; i-- {
+			rule := list.rules[i]
+			if rule.Match(rel, base, isDir) {
+				return !rule.negate
+			}
+		}
+	}
+	return false
+}
+
+// rel returns path relative to the folder containing the ignore file.
+func (list *ignoreList) rel(path string) string {
+	rel := path
+	if list.dir != "." {
+		rel = strings.TrimPrefix(path, list.dir)
+		rel = strings.TrimLeft(rel, string(filepath.Separator))
+	}
+	if list.sub != "" && list.sub != "." {
+		rel = filepath.Join(list.sub, rel)
+	}
+	return rel
+}
+
+// loadIgnoreFile adds the rules in filename to the chain.
+// Missing and empty files leave the chain unchanged.
+func loadIgnoreFile(fsys filesystem, parent *ignoreList, dir, sub, filename string) *ignoreList {
+	data, err := readFile(fsys, filename)
+	if err != nil {
+		return parent
+	}
+
+	rules := parseIgnoreFile(string(data))
+	if len(rules) == 0 {
+		return parent
+	}
+	return &ignoreList{
+		parent: parent,
+		dir:    dir,
+		sub:    sub,
+		rules:  rules,
+	}
+}
+
+// parseIgnoreFile parses rules in .gitignore format.
+func parseIgnoreFile(data string) []rule {
+	var rules []rule
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		// trailing spaces are ignored unless escaped
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+			line = line[:len(line)-1]
+		}
+
+		if strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+
+		rule, ok, err := compileRule(line)
+		if !ok || err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// enterDir returns the ignore files that apply inside dir,
+// given the ones that apply to its parent.
+func (scan *scanner) enterDir(parent *ignoreList, dir string) *ignoreList {
+	if !scan.gitignore {
+		return nil
+	}
+	return loadIgnoreFile(scan.fs, parent, dir, "", filepath.Join(dir, ".gitignore"))
+}
+
+// rootIgnores returns the ignore files that apply inside the
+// monitored folder dir: .gitignore files from the repository root
+// down to dir, .git/info/exclude and dir/.watchrunignore.
+func (scan *scanner) rootIgnores(dir string) *ignoreList {
+	if !scan.gitignore {
+		return nil
+	}
+
+	var ancestors []string
+	repository := ""
+	if abs, err := scan.fs.Abs(dir); err == nil {
+		for at := abs; ; {
+			ancestors = append(ancestors, at)
+			if _, err := scan.fs.Lstat(filepath.Join(at, ".git")); err == nil {
+				repository = at
+				break
+			}
+			parent := filepath.Dir(at)
+			if parent == at {
+				break
+			}
+			at = parent
+		}
+	}
+
+	var list *ignoreList
+	if repository != "" {
+		sub, _ := filepath.Rel(repository, ancestors[0])
+		list = loadIgnoreFile(scan.fs, list, dir, sub, filepath.Join(repository, ".git", "info", "exclude"))
+		for i := len(ancestors) - 1; i > 0; i-- {
+			sub, _ := filepath.Rel(ancestors[i], ancestors[0])
+			list = loadIgnoreFile(scan.fs, list, dir, sub, filepath.Join(ancestors[i], ".gitignore"))
+		}
+	}
+	list = scan.enterDir(list, dir)
+	return loadIgnoreFile(scan.fs, list, dir, "", filepath.Join(dir, ".watchrunignore"))
+}
@@ -0,0 +1,66 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGitIgnore(t *testing.T) {
+	dir := createTree(t,
+		".git/info/exclude",
+		".gitignore",
+		".watchrunignore",
+		"main.go",
+		"main.log",
+		"keep.log",
+		"notes.txt",
+		"build/out.js",
+		"web/build/page.html",
+		"web/.gitignore",
+		"web/app.js",
+		"web/app.min.js",
+		"web/vendor/lib.min.js",
+		"docs/build",
+	)
+
+	write := func(name, content string) {
+		err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", "# build output\n*.log\n!keep.log\n/build/\n")
+	write(".git/info/exclude", "notes.txt\n")
+	write(".watchrunignore", "docs/\n")
+	write("web/.gitignore", "*.min.js\n!vendor/*.min.js\nbuild/  \n")
+
+	scan := newScanner(Config{Ignore: []string{".*"}, Recurse: true, GitIgnore: true})
+	if err := scan.IncludeGlob(dir); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"keep.log",
+		"main.go",
+		"web/app.js",
+		"web/vendor/lib.min.js",
+	}
+	if got := scanned(scan, dir); !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+
+	// monitoring a subfolder still uses the parent ignore files
+	scan = newScanner(Config{Recurse: true, GitIgnore: true})
+	if err := scan.IncludeGlob(filepath.Join(dir, "web")); err != nil {
+		t.Fatal(err)
+	}
+	exp = []string{
+		"web/.gitignore",
+		"web/app.js",
+		"web/vendor/lib.min.js",
+	}
+	if got := scanned(scan, dir); !reflect.DeepEqual(got, exp) {
+		t.Errorf("subfolder: got %v, expected %v", got, exp)
+	}
+}
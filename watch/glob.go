@@ -15,6 +15,12 @@ var DefaultIgnore = []string{
 	"*.exe", "*.dll",
 }
 
+// Globs is a flag.Value for a list of patterns separated by ";" or ":".
+//
+// Patterns containing a "/" match the path relative to the monitored
+// directory, other patterns match the base name. Patterns are evaluated
+// in order and a pattern starting with "!" re-includes paths matched by
+// an earlier one, e.g. "!.env" after the default ".*".
 type Globs struct {
 	NoDefault  bool
 	Default    []string
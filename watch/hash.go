@@ -0,0 +1,31 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"io"
+)
+
+// hash is a digest of file content.
+type hash [sha256.Size]byte
+
+// IsZero reports whether the hash is missing.
+func (h hash) IsZero() bool { return h == hash{} }
+
+// hashFile returns the digest of the file content or
+// the zero hash when the file cannot be read.
+func hashFile(fsys filesystem, path string) hash {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return hash{}
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return hash{}
+	}
+
+	var h hash
+	digest.Sum(h[:0])
+	return h
+}
@@ -0,0 +1,75 @@
+package watch
+
+import (
+	"os"
+	"sync"
+)
+
+// listings caches directory listings between scans. A listing is
+// reused only when the notifier reports that the directory had no
+// events. When polling, every directory is listed again, since the
+// files in it have to be checked for modifications anyway.
+type listings struct {
+	previous map[string][]os.FileInfo
+
+	// mu guards current, which is filled concurrently
+	// when directories are listed in parallel
+	mu      sync.Mutex
+	current map[string][]os.FileInfo
+
+	// dirty are the directories with events, when known
+	dirty map[string]bool
+	known bool
+}
+
+func newListings() *listings {
+	return &listings{
+		previous: make(map[string][]os.FileInfo),
+		current:  make(map[string][]os.FileInfo),
+	}
+}
+
+// Begin starts a new scan. When known is true, only the directories
+// in dirty may have changed since the previous scan.
+func (cache *listings) Begin(dirty map[string]bool, known bool) {
+	cache.current = make(map[string][]os.FileInfo, len(cache.previous))
+	cache.dirty = dirty
+	cache.known = known
+}
+
+// End finishes a scan, forgetting directories that were not visited.
+func (cache *listings) End() {
+	cache.previous = cache.current
+	cache.current = nil
+}
+
+// ReadDir returns the entries of dir, reusing the previous listing
+// when the directory had no events.
+func (cache *listings) ReadDir(fsys filesystem, dir string) ([]os.FileInfo, error) {
+	if cached, ok := cache.previous[dir]; ok && cache.known && !cache.dirty[dir] {
+		cache.store(dir, cached)
+		return cached, nil
+	}
+
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	cache.store(dir, entries)
+	return entries, nil
+}
+
+// store records the listing of dir for the next scan.
+func (cache *listings) store(dir string, entries []os.FileInfo) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.current[dir] = entries
+}
+
+// listDir lists dir using the cache, when incremental.
+func (scan *scanner) listDir(dir string) ([]os.FileInfo, error) {
+	if scan.listings == nil {
+		return scan.fs.ReadDir(dir)
+	}
+	return scan.listings.ReadDir(scan.fs, dir)
+}
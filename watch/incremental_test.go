@@ -0,0 +1,117 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIncremental(t *testing.T) {
+	dir := createTree(t, "main.go", "sub/util.go", "sub/deep/data.txt")
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{"", "sub", "sub/deep"} {
+		if err := os.Chtimes(filepath.Join(dir, name), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := newListings()
+	scan := func(incremental bool, dirty map[string]bool, known bool) filetimes {
+		scan := newScanner(Config{Recurse: true})
+		if incremental {
+			scan.listings = cache
+			cache.Begin(dirty, known)
+			defer cache.End()
+		}
+		if err := scan.IncludeGlob(dir); err != nil {
+			t.Fatal(err)
+		}
+		return scan.times
+	}
+	check := func(step string, dirty map[string]bool, known bool) {
+		t.Helper()
+		full, incremental := scan(false, nil, false), scan(true, dirty, known)
+		if !reflect.DeepEqual(full, incremental) {
+			t.Errorf("%s: incremental scan %v differs from full scan %v", step, incremental, full)
+		}
+	}
+
+	check("initial", nil, false)
+	check("unchanged", nil, false)
+
+	// modified in place, the directory stays the same
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "sub", "util.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	check("modified", nil, false)
+	check("modified with events", map[string]bool{filepath.Join(dir, "sub"): true}, true)
+
+	if err := os.WriteFile(filepath.Join(dir, "sub", "deep", "new.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check("created", nil, false)
+
+	if err := os.Remove(filepath.Join(dir, "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	check("deleted", map[string]bool{dir: true}, true)
+}
+
+// benchmarkTree creates a tree with dirs*dirs folders of files each.
+func benchmarkTree(b *testing.B, dirs, files int) string {
+	b.Helper()
+	root := b.TempDir()
+	past := time.Now().Add(-time.Hour)
+	for i := 0; i < dirs; i++ {
+		for k := 0; k < dirs; k++ {
+			dir := filepath.Join(root, fmt.Sprintf("pkg%d", i), fmt.Sprintf("sub%d", k))
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				b.Fatal(err)
+			}
+			for f := 0; f < files; f++ {
+				name := filepath.Join(dir, fmt.Sprintf("file%d.go", f))
+				if err := os.WriteFile(name, nil, 0o644); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := os.Chtimes(dir, past, past); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := os.Chtimes(filepath.Join(root, fmt.Sprintf("pkg%d", i)), past, past); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return root
+}
+
+func benchmarkScan(b *testing.B, incremental, notified bool) {
+	root := benchmarkTree(b, 20, 20)
+	config := Config{Ignore: DefaultIgnore, Recurse: true}
+
+	cache := newListings()
+	scan := func() {
+		scan := newScanner(config)
+		if incremental {
+			scan.listings = cache
+			cache.Begin(nil, notified)
+			defer cache.End()
+		}
+		if err := scan.IncludeGlob(root); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	scan()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scan()
+	}
+}
+
+func BenchmarkScanFull(b *testing.B)                { benchmarkScan(b, false, false) }
+func BenchmarkScanIncrementalNotified(b *testing.B) { benchmarkScan(b, true, true) }
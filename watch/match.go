@@ -0,0 +1,344 @@
+package watch
+
+import (
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// Match reports whether name matches the shell pattern.
+//
+// The pattern syntax extends filepath.Match:
+//
+//	pattern:
+//		{ term }
+//	term:
+//		'*'         matches any sequence of non-separator characters
+//		'**'        as a whole path element, matches any number of
+//		            path elements, including none
+//		'?'         matches any single non-separator character
+//		'[' [ '!' | '^' ] { character-range } ']'
+//		            character class (must be non-empty)
+//		'{' pattern { ',' pattern } '}'
+//		            matches any of the alternatives
+//		c           matches character c (c != '*', '?', '\\', '[', '{')
+//		'\\' c      matches character c
+//
+//	character-range:
+//		c           matches character c (c != '\\', '-', ']')
+//		'\\' c      matches character c
+//		lo '-' hi   matches character c for lo <= c <= hi
+//
+// On Windows, escaping is disabled and '\\' is treated as a path separator.
+// Match requires pattern to match all of name.
+// The only possible returned error is filepath.ErrBadPattern.
+func Match(pattern, name string) (matched bool, err error) {
+	glob, err := compileGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+	return glob.Match(name), nil
+}
+
+// glob is a compiled pattern.
+type glob struct {
+	pattern string
+	literal bool
+	re      *regexp.Regexp
+}
+
+func compileGlob(pattern string) (*glob, error) {
+	pattern = filepath.ToSlash(pattern)
+	if !hasMeta(pattern) {
+		return &glob{pattern: cname(pattern), literal: true}, nil
+	}
+
+	var rx strings.Builder
+	rx.WriteString("^(?s")
+	if runtime.GOOS == "windows" {
+		rx.WriteString("i")
+	}
+	rx.WriteString(")(?:")
+
+	p := globParser{pattern: pattern}
+	if err := p.parse(&rx, false); err != nil {
+		return nil, err
+	}
+	rx.WriteString(")$")
+
+	re, err := regexp.Compile(rx.String())
+	if err != nil {
+		return nil, filepath.ErrBadPattern
+	}
+	return &glob{pattern: pattern, re: re}, nil
+}
+
+// rule is an ignore or care pattern.
+//
+// Like in .gitignore, a pattern containing a separator is anchored
+// to the monitor root and matches the relative path, otherwise it
+// matches the base name at any depth. A pattern ending with a
+// separator only matches directories and a pattern starting with
+// "!" re-includes paths excluded by an earlier pattern.
+type rule struct {
+	// pattern as it was given
+	pattern  string
+	glob     *glob
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// compileRule compiles a single pattern.
+// It returns false for patterns that do not match anything.
+func compileRule(pattern string) (rule, bool, error) {
+	r := rule{pattern: pattern}
+	if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+		r.negate = true
+		pattern = negated
+	} else if strings.HasPrefix(pattern, `\!`) {
+		pattern = pattern[1:]
+	}
+
+	pattern = filepath.ToSlash(pattern)
+	if trimmed, ok := strings.CutSuffix(pattern, "/"); ok {
+		r.dirOnly = true
+		pattern = trimmed
+	}
+	r.anchored = strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return r, false, nil
+	}
+
+	glob, err := compileGlob(pattern)
+	if err != nil {
+		return r, false, err
+	}
+	r.glob = glob
+	return r, true, nil
+}
+
+// compileRules compiles all valid patterns, keeping their order.
+func compileRules(patterns []string) []rule {
+	rules := make([]rule, 0, len(patterns))
+	for _, pattern := range patterns {
+		rule, ok, err := compileRule(pattern)
+		if !ok || err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// matchRules reports whether the rules select a path.
+// The last matching rule wins, so a negated rule can
+// undo an earlier match.
+func matchRules(rules []rule, rel, base string, isDir bool) bool {
+	return matchRule(rules, rel, base, isDir) != nil
+}
+
+// matchRule returns the rule that selects a path or nil, see matchRules.
+func matchRule(rules []rule, rel, base string, isDir bool) *rule {
+	var matched *rule
+	for i := range rules {
+		rule := &rules[i]
+		if (matched != nil) == rule.negate && rule.Match(rel, base, isDir) {
+			matched = rule
+			if rule.negate {
+				matched = nil
+			}
+		}
+	}
+	return matched
+}
+
+// Match reports whether the rule matches a path, given
+// relative to the monitor root, with the specified base name.
+func (rule rule) Match(rel, base string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if rule.anchored {
+		return rule.glob.Match(rel)
+	}
+	return rule.glob.Match(base)
+}
+
+// Match reports whether name matches the glob.
+func (glob *glob) Match(name string) bool {
+	name = filepath.ToSlash(name)
+	if glob.literal {
+		return cname(name) == glob.pattern
+	}
+	return glob.re.MatchString(name)
+}
+
+// metaIndex returns the index of the first special character in pattern,
+// or -1 if there is none.
+func metaIndex(pattern string) int {
+	if runtime.GOOS == "windows" {
+		return strings.IndexAny(pattern, `*?[{`)
+	}
+	return strings.IndexAny(pattern, `*?[{\`)
+}
+
+// hasMeta reports whether pattern contains any of the special characters.
+func hasMeta(pattern string) bool {
+	return metaIndex(pattern) >= 0
+}
+
+// hasDeepMeta reports whether pattern may match paths with
+// a varying number of elements.
+func hasDeepMeta(pattern string) bool {
+	return strings.Contains(pattern, "**") || strings.Contains(pattern, "{")
+}
+
+// globParser translates a glob pattern into a regular expression.
+type globParser struct {
+	pattern string
+	pos     int
+}
+
+func (p *globParser) parse(rx *strings.Builder, alternative bool) error {
+	for p.pos < len(p.pattern) {
+		switch c := p.pattern[p.pos]; c {
+		case '*':
+			start := p.pos
+			for p.pos < len(p.pattern) && p.pattern[p.pos] == '*' {
+				p.pos++
+			}
+			whole := p.pos-start >= 2 &&
+				(start == 0 || p.pattern[start-1] == '/') &&
+				(p.pos == len(p.pattern) || p.pattern[p.pos] == '/')
+			switch {
+			case !whole:
+				rx.WriteString(`[^/]*`)
+			case p.pos < len(p.pattern):
+				// "**/" also matches no elements at all
+				rx.WriteString(`(?:.*/)?`)
+				p.pos++
+			default:
+				rx.WriteString(`.*`)
+			}
+		case '?':
+			rx.WriteString(`[^/]`)
+			p.pos++
+		case '[':
+			if err := p.parseClass(rx); err != nil {
+				return err
+			}
+		case '{':
+			p.pos++
+			rx.WriteString(`(?:`)
+			for {
+				if err := p.parse(rx, true); err != nil {
+					return err
+				}
+				if p.pos >= len(p.pattern) {
+					return filepath.ErrBadPattern
+				}
+				p.pos++
+				if p.pattern[p.pos-1] == '}' {
+					break
+				}
+				rx.WriteString(`|`)
+			}
+			rx.WriteString(`)`)
+		case ',', '}':
+			if alternative {
+				return nil
+			}
+			rx.WriteString(regexp.QuoteMeta(string(c)))
+			p.pos++
+		case '\\':
+			// only reachable outside of Windows, where
+			// ToSlash has not turned it into a separator
+			p.pos++
+			if p.pos >= len(p.pattern) {
+				return filepath.ErrBadPattern
+			}
+			r, size := utf8.DecodeRuneInString(p.pattern[p.pos:])
+			rx.WriteString(regexp.QuoteMeta(string(r)))
+			p.pos += size
+		default:
+			r, size := utf8.DecodeRuneInString(p.pattern[p.pos:])
+			rx.WriteString(regexp.QuoteMeta(string(r)))
+			p.pos += size
+		}
+	}
+	if alternative {
+		return filepath.ErrBadPattern
+	}
+	return nil
+}
+
+func (p *globParser) parseClass(rx *strings.Builder) error {
+	p.pos++ // '['
+	rx.WriteString(`[`)
+	if p.pos < len(p.pattern) && (p.pattern[p.pos] == '!' || p.pattern[p.pos] == '^') {
+		rx.WriteString(`^/`)
+		p.pos++
+	}
+
+	empty := true
+	for {
+		if p.pos >= len(p.pattern) {
+			return filepath.ErrBadPattern
+		}
+		if p.pattern[p.pos] == ']' && !empty {
+			p.pos++
+			break
+		}
+
+		lo, err := p.classChar()
+		if err != nil {
+			return err
+		}
+		rx.WriteString(quoteClass(lo))
+		if p.pos < len(p.pattern) && p.pattern[p.pos] == '-' {
+			p.pos++
+			hi, err := p.classChar()
+			if err != nil {
+				return err
+			}
+			if hi < lo {
+				return filepath.ErrBadPattern
+			}
+			rx.WriteString(`-`)
+			rx.WriteString(quoteClass(hi))
+		}
+		empty = false
+	}
+	rx.WriteString(`]`)
+	return nil
+}
+
+func (p *globParser) classChar() (rune, error) {
+	if p.pos >= len(p.pattern) {
+		return 0, filepath.ErrBadPattern
+	}
+	switch p.pattern[p.pos] {
+	case '-', ']':
+		return 0, filepath.ErrBadPattern
+	case '\\':
+		p.pos++
+		if p.pos >= len(p.pattern) {
+			return 0, filepath.ErrBadPattern
+		}
+	}
+	r, size := utf8.DecodeRuneInString(p.pattern[p.pos:])
+	p.pos += size
+	return r, nil
+}
+
+func quoteClass(r rune) string {
+	switch r {
+	case '\\', ']', '[', '^', '-':
+		return `\` + string(r)
+	}
+	return string(r)
+}
@@ -0,0 +1,317 @@
+package watch
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+		err     bool
+	}{
+		{"abc", "abc", true, false},
+		{"abc", "abd", false, false},
+		{"*", "abc", true, false},
+		{"*", "a/b", false, false},
+		{"*.go", "main.go", true, false},
+		{"*.go", "cmd/main.go", false, false},
+		{"a?c", "abc", true, false},
+		{"a?c", "a/c", false, false},
+
+		{"**", "a", true, false},
+		{"**", "a/b/c", true, false},
+		{"**/*.go", "main.go", true, false},
+		{"**/*.go", "cmd/server/main.go", true, false},
+		{"**/*.go", "cmd/server/main.js", false, false},
+		{"src/**", "src/a", true, false},
+		{"src/**", "src/a/b", true, false},
+		{"src/**", "other/a", false, false},
+		{"src/**/test", "src/test", true, false},
+		{"src/**/test", "src/a/b/test", true, false},
+		{"src/**/test", "src/a/b/test2", false, false},
+		{"a**b", "axxb", true, false},
+		{"a**b", "ax/xb", false, false},
+
+		{"*.{js,css}", "main.js", true, false},
+		{"*.{js,css}", "main.css", true, false},
+		{"*.{js,css}", "main.go", false, false},
+		{"{src,lib}/*.go", "lib/a.go", true, false},
+		{"{src,lib}/*.go", "cmd/a.go", false, false},
+		{"{a,b{c,d}}", "bd", true, false},
+		{"{a,b{c,d}}", "b", false, false},
+		{"x{,.bak}", "x", true, false},
+		{"x{,.bak}", "x.bak", true, false},
+
+		{"[abc].go", "b.go", true, false},
+		{"[abc].go", "d.go", false, false},
+		{"[a-c].go", "c.go", true, false},
+		{"[!a-c].go", "d.go", true, false},
+		{"[!a-c].go", "a.go", false, false},
+		{"[^a-c].go", "d.go", true, false},
+		{"*.[ao]", "x.o", true, false},
+		{"[!x]", "/", false, false},
+		{"[]-]", "-", false, true},
+		{"a.b", "axb", false, false},
+		{"a+b", "a+b", true, false},
+
+		{"[", "a", false, true},
+		{"[a-", "a", false, true},
+		{"[z-a]", "a", false, true},
+		{"{a,b", "a", false, true},
+		{"*.{js", "a.js", false, true},
+	}
+	for _, test := range tests {
+		match, err := Match(test.pattern, test.name)
+		if (err != nil) != test.err {
+			t.Errorf("Match(%q, %q) error = %v, expected err=%v", test.pattern, test.name, err, test.err)
+			continue
+		}
+		if match != test.match {
+			t.Errorf("Match(%q, %q) = %v, expected %v", test.pattern, test.name, match, test.match)
+		}
+	}
+}
+
+// createTree creates empty files in a temporary directory.
+func createTree(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// scanned returns the sorted paths found by scan relative to dir.
+func scanned(scan *scanner, dir string) []string {
+	files := []string{}
+	for file := range scan.times {
+		rel, _ := filepath.Rel(dir, file)
+		files = append(files, filepath.ToSlash(rel))
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestIncludeGlob(t *testing.T) {
+	dir := createTree(t,
+		"main.go",
+		"README.md",
+		"cmd/server/main.go",
+		"cmd/server/server.log",
+		"web/app.js",
+		"web/app.css",
+		"web/lib/util.js",
+		".git/config",
+	)
+
+	tests := []struct {
+		glob    string
+		recurse bool
+		exp     []string
+	}{
+		{"*.go", false, []string{"main.go"}},
+		{"**/*.go", false, []string{"cmd/server/main.go", "main.go"}},
+		{"web/*.{js,css}", false, []string{"web/app.css", "web/app.js"}},
+		{"web/**/*.js", false, []string{"web/app.js", "web/lib/util.js"}},
+		{"cmd/**", false, []string{"cmd/server/main.go"}},
+		{"cmd/**", true, []string{"cmd/server/main.go"}},
+		{"web", true, []string{"web/app.css", "web/app.js", "web/lib/util.js"}},
+		{"[Rm]*", false, []string{"README.md", "main.go"}},
+		// ignore rules do not apply to the files a pattern names directly
+		{"cmd/server/*.log", false, []string{"cmd/server/server.log"}},
+		{"cmd/*/*.log", true, []string{"cmd/server/server.log"}},
+	}
+	for _, test := range tests {
+		scan := newScanner(Config{Ignore: DefaultIgnore, Recurse: test.recurse})
+		if err := scan.IncludeGlob(filepath.Join(dir, filepath.FromSlash(test.glob))); err != nil {
+			t.Errorf("IncludeGlob(%q): %v", test.glob, err)
+			continue
+		}
+
+		got := scanned(scan, dir)
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("IncludeGlob(%q, recurse=%v) = %v, expected %v", test.glob, test.recurse, got, test.exp)
+		}
+	}
+}
+
+func TestIncludeGlobCare(t *testing.T) {
+	dir := createTree(t, "logs/app.log", "logs/old/app.log", "main.go")
+
+	// care does not apply to the files a pattern names directly either
+	scan := newScanner(Config{Ignore: DefaultIgnore, Care: []string{"*.go"}, Recurse: true})
+	if err := scan.IncludeGlob(filepath.Join(dir, "logs", "*.log")); err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := scanned(scan, dir), []string{"logs/app.log"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestRules(t *testing.T) {
+	dir := createTree(t,
+		".env",
+		".editorconfig",
+		"cmd/server/main.go",
+		"cmd/server/main_test.go",
+		"cmd/client/main.go",
+		"frontend/node_modules/x/index.js",
+		"frontend/src/node_modules/index.js",
+		"frontend/src/main.js",
+		"testdata/golden.log",
+		"testdata/debug.log",
+	)
+
+	tests := []struct {
+		ignore []string
+		care   []string
+		exp    []string
+	}{
+		{
+			ignore: []string{".*", "*.log", "frontend/node_modules"},
+			exp: []string{
+				"cmd/client/main.go",
+				"cmd/server/main.go",
+				"cmd/server/main_test.go",
+				"frontend/src/main.js",
+				"frontend/src/node_modules/index.js",
+			},
+		},
+		{
+			ignore: []string{".*", "*.log", "node_modules"},
+			exp: []string{
+				"cmd/client/main.go",
+				"cmd/server/main.go",
+				"cmd/server/main_test.go",
+				"frontend/src/main.js",
+			},
+		},
+		{
+			ignore: []string{"/frontend"},
+			care:   []string{"cmd/server/*.go", "!*_test.go"},
+			exp:    []string{"cmd/server/main.go"},
+		},
+		{
+			care: []string{"**/src/*.js"},
+			exp:  []string{"frontend/src/main.js"},
+		},
+		{
+			ignore: []string{".*", "*.log", "frontend", "!.env", "!testdata/golden.log"},
+			exp: []string{
+				".env",
+				"cmd/client/main.go",
+				"cmd/server/main.go",
+				"cmd/server/main_test.go",
+				"testdata/golden.log",
+			},
+		},
+		{
+			ignore: []string{"!cmd", "cmd"},
+			care:   []string{"*.go", "!*_test.go"},
+			exp:    []string{},
+		},
+		{
+			care: []string{"*.go", "!*_test.go", "!cmd/client/*", "cmd/client/main.go"},
+			exp:  []string{"cmd/client/main.go", "cmd/server/main.go"},
+		},
+	}
+	for _, test := range tests {
+		scan := newScanner(Config{Ignore: test.ignore, Care: test.care, Recurse: true})
+		if err := scan.IncludeGlob(dir); err != nil {
+			t.Fatal(err)
+		}
+		got := scanned(scan, dir)
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("ignore=%q care=%q: got %v, expected %v", test.ignore, test.care, got, test.exp)
+		}
+	}
+}
+
+func TestStartInvalidPatterns(t *testing.T) {
+	for _, config := range []Config{
+		{Monitor: []string{"src/{a,b"}},
+		{Ignore: []string{"[z-a]"}},
+		{Care: []string{"!*.[go"}},
+	} {
+		watch, err := Start(config)
+		if err == nil {
+			watch.Stop()
+			t.Errorf("Start(%+v) succeeded, expected an error", config)
+		}
+	}
+}
+
+func TestNewInvalidPatterns(t *testing.T) {
+	// the deprecated constructor keeps watching without the invalid patterns
+	dir := createTree(t, "main.go", "build.log")
+	watch := New(time.Millisecond, []string{dir}, []string{"[z-a]", "*.log"}, nil, true)
+	defer func() {
+		watch.Stop()
+		<-watch.Done()
+	}()
+
+	changes := <-watch.Changes
+	if len(changes) != 1 || filepath.Base(changes[0].Path) != "main.go" {
+		t.Errorf("got %v, expected main.go to be created", changes)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":        {Data: []byte("package main")},
+		"small.go":       {Data: []byte("package")},
+		"small.txt":      {Data: []byte("text")},
+		"gen/api.go":     {Data: []byte("gen")},
+		"sub/gen.go":     {Data: []byte("gen")},
+		"sub/deep/x.go":  {Data: []byte("x")},
+		"sub/deep/y.txt": {Data: []byte("y")},
+	}
+
+	var visited []string
+	times := scanFS(t, Config{
+		FS:      fsys,
+		Monitor: []string{"."},
+		Care:    []string{"*.go"},
+		Recurse: true,
+		Filter: func(path string, info fs.FileInfo) bool {
+			visited = append(visited, filepath.ToSlash(path))
+			if info.IsDir() {
+				return info.Name() != "gen"
+			}
+			return info.Size() < 10
+		},
+	}, nil)
+
+	got := []string{}
+	for file := range times {
+		got = append(got, filepath.ToSlash(file))
+	}
+	sort.Strings(got)
+	exp := []string{"small.go", "sub/deep/x.go", "sub/gen.go"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+
+	// the filter is not called for entries ignored by the globs
+	sort.Strings(visited)
+	exp = []string{"gen", "main.go", "small.go", "sub", "sub/deep", "sub/deep/x.go", "sub/gen.go"}
+	if !reflect.DeepEqual(visited, exp) {
+		t.Errorf("visited %v, expected %v", visited, exp)
+	}
+}
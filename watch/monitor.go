@@ -1,57 +1,255 @@
 package watch
 
 import (
-	"io/ioutil"
+	"context"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
-const (
-	running  = 0
-	stopping = 1
-	stopped  = 2
-)
+// Config configures a Watch.
+type Config struct {
+	// Interval defines how often to poll the disk.
+	Interval time.Duration
+	// MaxInterval enables adaptive polling when larger than Interval.
+	// While nothing changes the interval doubles after every scan up to
+	// MaxInterval and it returns to Interval after a change. Scans that
+	// take longer than half of the interval lengthen it as well.
+	MaxInterval time.Duration
+	// Quiet is how long files must stay unchanged before the
+	// changes are reported, defaults to Interval.
+	Quiet time.Duration
+	// MaxWait reports changes even when files keep changing for
+	// longer than this, defaults to 10*Quiet. Negative disables it.
+	MaxWait time.Duration
+	// WaitStable holds back the changes to files whose size or
+	// modification time still differs between consecutive scans, such
+	// as files that are being copied, for at most this long. The other
+	// changes are reported without them. Zero disables it.
+	WaitStable time.Duration
+	// Clock is used for waiting and timing, defaults to the real time.
+	// Any other clock polls the files, since file system events
+	// arrive in real time.
+	Clock Clock
+
+	// Monitor these globs for changes, defaults to the current directory.
+	Monitor []string
+	// Ignore files and folders that match these globs.
+	Ignore []string
+	// Care only about files that match these globs.
+	Care []string
+	// Recurse into monitored folders.
+	Recurse bool
+	// Filter is called for the files and folders that are not
+	// ignored by the globs, returning false ignores them and
+	// everything inside a folder. It is called from a single goroutine.
+	Filter func(path string, info fs.FileInfo) bool
+
+	// FS scans these files instead of the disk, for example an
+	// embedded tree or an fstest.MapFS. Monitor paths are relative to
+	// its root and the files are polled every Interval.
+	FS fs.FS
+
+	// Hash compares the content of files, instead of only the
+	// modification time, to skip changes where the content is the same.
+	// Files are rehashed only when their size or modification time changes.
+	Hash bool
+
+	// Attributes additionally compares the size, mode, inode and change
+	// time of files, to notice edits that keep the modification time,
+	// such as on file systems with a coarse one or when tools restore it.
+	Attributes bool
+
+	// DetectRenames reports a deleted and a created file with the same
+	// device, inode, size and modification time as a single "rename"
+	// change. Where inodes are not
+	// available, files are matched by size and hash, which requires Hash.
+	DetectRenames bool
+
+	// FollowSymlinks scans the targets of symbolic links and reports
+	// changes under the link path. Links back to a directory that
+	// contains them are skipped to avoid loops.
+	FollowSymlinks bool
+
+	// Incremental caches directory listings between scans and, with
+	// inotify, lists only the directories that had events. It does not
+	// help when polling, where every directory is listed again.
+	Incremental bool
+
+	// Concurrency is how many directories are listed at the same time.
+	// The results are the same as listing them one by one, which is
+	// the default.
+	Concurrency int
+
+	// Dirs includes directories in the changes, so that creating or
+	// deleting a directory is reported even when it has no monitored files.
+	Dirs bool
+
+	// GitIgnore additionally ignores files listed in .gitignore files,
+	// .git/info/exclude and .watchrunignore in the monitored folder.
+	GitIgnore bool
+
+	// StateFile saves the files to this file when the watch stops and
+	// loads them on start, so that the first changes contain only what
+	// changed while not watching. The state file itself is not monitored.
+	StateFile string
+	// SkipUnchanged does not send a batch on start when the loaded
+	// state matches the files. Otherwise an empty batch is sent, so
+	// that commands run once like they would without a state file.
+	SkipUnchanged bool
+
+	// OnStats is called with the statistics of every scan.
+	OnStats func(stats Stats)
+
+	// OnError is called with errors that happen while scanning, such as
+	// unreadable folders or vanished monitor paths. The same error is
+	// reported again only after it has disappeared for a scan.
+	OnError func(err error)
+}
+
+// validate checks that all the patterns are valid.
+func (config *Config) validate() error {
+	for _, glob := range config.Monitor {
+		if !hasMeta(glob) {
+			continue
+		}
+		if _, err := compileGlob(filepath.Clean(glob)); err != nil {
+			return fmt.Errorf("invalid monitor pattern %q: %w", glob, err)
+		}
+	}
+	for _, pattern := range config.Ignore {
+		if _, _, err := compileRule(pattern); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range config.Care {
+		if _, _, err := compileRule(pattern); err != nil {
+			return fmt.Errorf("invalid care pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
 
 type Watch struct {
 	Changes chan []Change
 
-	once  sync.Once
-	stage int32
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed after Run has exited, err is the reason for it
+	done chan struct{}
+	err  error
+
+	// hub delivers the changes to subscriptions, after the first one
+	subscribe sync.Once
+	hub       *hub
 
+	config Config
+	notify notifier
+	// last is the most recent scan
+	last filetimes
+	// errors reported by the most recent scan
+	errors map[string]bool
+	// listings from the previous scan, when incremental
+	listings *listings
+	// interval is the current polling interval
 	interval time.Duration
+	// unstable are the files that changed between the last two scans
+	unstable map[string]bool
+	// holding are the files held back and since when
+	holding map[string]time.Time
 
-	monitor []string
-	ignore  []string
-	care    []string
-	recurse bool
+	mu sync.Mutex
+	// stats of the most recent scan
+	stats Stats
 }
 
+// New starts watching for changes. Invalid patterns never match.
+//
+// Deprecated: Use Start, which takes a Config and reports invalid patterns.
 func New(interval time.Duration, monitor, ignore, care []string, recurse bool) *Watch {
+	return start(context.Background(), Config{
+		Interval: interval,
+		Monitor:  monitor,
+		Ignore:   ignore,
+		Care:     care,
+		Recurse:  recurse,
+	})
+}
+
+// Start starts watching for changes.
+// It returns an error when any of the patterns is invalid.
+func Start(config Config) (*Watch, error) {
+	return NewContext(context.Background(), config)
+}
+
+// NewContext starts watching for changes until ctx is canceled or
+// Stop is called, even when nobody is reading Changes.
+// It returns an error when any of the patterns is invalid.
+func NewContext(ctx context.Context, config Config) (*Watch, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return start(ctx, config), nil
+}
+
+// start starts watching with the defaults filled in.
+func start(ctx context.Context, config Config) *Watch {
+	if len(config.Monitor) == 0 {
+		config.Monitor = []string{"."}
+	}
+	if config.Interval <= 0 {
+		config.Interval = 300 * time.Millisecond
+	}
+	if config.Quiet <= 0 {
+		config.Quiet = config.Interval
+	}
+	if config.MaxWait == 0 {
+		config.MaxWait = 10 * config.Quiet
+	}
+	if config.Clock == nil {
+		config.Clock = systemClock{}
+	}
+
 	watch := &Watch{}
 	watch.Changes = make(chan []Change)
-	watch.interval = interval
-	watch.monitor = monitor
-	if len(watch.monitor) == 0 {
-		watch.monitor = []string{"."}
-	}
-	watch.ignore = ignore
-	watch.recurse = recurse
-	watch.care = care
+	watch.ctx, watch.cancel = context.WithCancel(ctx)
+	watch.done = make(chan struct{})
+	watch.config = config
+	watch.interval = config.Interval
+	if config.Incremental {
+		watch.listings = newListings()
+	}
 	watch.Start()
 	return watch
 }
 
-func (watch *Watch) Stop() {
-	watch.once.Do(func() {
-		atomic.StoreInt32(&watch.stage, stopping)
-	})
+// Stop stops watching, Done is closed once the watching has finished.
+func (watch *Watch) Stop() { watch.cancel() }
+
+// Done returns a channel that is closed after Changes has
+// been closed and the state file has been saved.
+func (watch *Watch) Done() <-chan struct{} { return watch.done }
+
+// Err returns nil until Done is closed, and afterwards the reason
+// for stopping, context.Canceled after Stop.
+func (watch *Watch) Err() error {
+	select {
+	case <-watch.done:
+		return watch.err
+	default:
+		return nil
+	}
 }
 
+// Changes starts watching and returns the changes.
+//
+// Deprecated: Use Start and Watch.Changes.
 func Changes(interval time.Duration, monitor, ignore, care []string, recurse bool) chan []Change {
 	watch := New(interval, monitor, ignore, care, recurse)
 	return watch.Changes
@@ -65,145 +263,630 @@ func (watch *Watch) Wait() bool {
 func (watch *Watch) Start() { go watch.Run() }
 
 func (watch *Watch) Run() {
-	defer atomic.StoreInt32(&watch.stage, stopped)
+	defer close(watch.done)
+	defer func() { watch.err = context.Cause(watch.ctx) }()
 	defer close(watch.Changes)
 
-	previous := make(filetimes)
-	for {
-		if atomic.LoadInt32(&watch.stage) >= stopping {
-			break
-		}
+	watch.notify = watch.newNotifier()
+	defer func() { watch.notify.Close() }()
 
-		next := watch.getState()
+	previous, loaded := watch.load()
+	defer func() { watch.save(previous) }()
+
+	for !watch.stopping() {
+		start := watch.config.Clock.Now()
+		next := watch.scan()
+		watch.adapt(!previous.Same(next), watch.config.Clock.Now().Sub(start))
+		if loaded {
+			loaded = false
+			if previous.Same(next) && !watch.config.SkipUnchanged {
+				watch.send([]Change{})
+				continue
+			}
+		}
 		if !previous.Same(next) {
-			time.Sleep(watch.interval)
-			next = watch.getState()
-			changes := previous.Changes(next)
-			previous = next
-			watch.Changes <- changes
+			next = watch.settle(next)
+			if watch.config.WaitStable > 0 {
+				next = watch.holdUnstable(previous, next)
+			}
+			changes := watch.changes(previous, next)
+			if len(changes) == 0 || watch.send(changes) {
+				previous = next
+			}
 			continue
 		}
-		time.Sleep(watch.interval)
+
+		for !watch.notify.Wait(watch.ctx.Done(), watch.interval) {
+			if watch.stopping() {
+				break
+			}
+		}
 	}
 }
 
-func (watch *Watch) getState() filetimes {
-	times := make(filetimes)
-	for _, glob := range watch.monitor {
-		times.IncludeGlob(glob, watch.ignore, watch.care, watch.recurse)
+func (watch *Watch) stopping() bool {
+	return watch.ctx.Err() != nil
+}
+
+// send sends changes unless the watch is stopped before they are received.
+func (watch *Watch) send(changes []Change) bool {
+	select {
+	case watch.Changes <- changes:
+		return true
+	case <-watch.ctx.Done():
+		return false
 	}
-	return times
 }
 
-type filetimes map[string]time.Time
+// settle rescans until the files have not changed for the quiet
+// period or until the maximum wait has passed.
+func (watch *Watch) settle(next filetimes) filetimes {
+	start := watch.config.Clock.Now()
+	changed := start
+	for !watch.stopping() {
+		now := watch.config.Clock.Now()
+		timeout := watch.config.Quiet - now.Sub(changed)
+		if watch.config.MaxWait > 0 {
+			timeout = min(timeout, watch.config.MaxWait-now.Sub(start))
+		}
+		if timeout <= 0 {
+			break
+		}
+
+		if watch.notify.Wait(watch.ctx.Done(), min(timeout, watch.config.Interval)) {
+			if scan := watch.scan(); !scan.Same(next) {
+				next = scan
+				changed = watch.config.Clock.Now()
+			}
+		} else {
+			// without events the files have not changed
+			watch.unstable = nil
+		}
+	}
+	return next
+}
+
+// load returns the files from the state file, when there is one.
+func (watch *Watch) load() (previous filetimes, loaded bool) {
+	if watch.config.StateFile != "" {
+		files, err := loadState(watch.config.StateFile)
+		if err != nil {
+			watch.report(err)
+		}
+		if files != nil {
+			return files, true
+		}
+	}
+	return make(filetimes), false
+}
+
+// save writes the last reported files to the state file, when there is one.
+func (watch *Watch) save(files filetimes) {
+	if watch.config.StateFile == "" {
+		return
+	}
+	if err := saveState(watch.config.StateFile, files); err != nil {
+		watch.report(fmt.Errorf("saving state: %w", err))
+	}
+}
+
+// scan returns the current state and updates the watched directories.
+func (watch *Watch) scan() filetimes {
+	last := watch.last
+	next, dirs := watch.getState()
+	watch.track(dirs)
+	if watch.config.WaitStable > 0 {
+		watch.trackUnstable(last, next)
+	}
+	return next
+}
+
+// changes returns the differences between two scans.
+func (watch *Watch) changes(previous, next filetimes) []Change {
+	if watch.config.DetectRenames {
+		return previous.Renames(next)
+	}
+	return previous.Changes(next)
+}
+
+// newNotifier returns the notifier for the configured files.
+func (watch *Watch) newNotifier() notifier {
+	_, system := watch.config.Clock.(systemClock)
+	if watch.config.FS != nil || !system {
+		return poller{watch.config.Clock}
+	}
+	return newNotifier()
+}
+
+// track updates the watched directories, falling back to
+// polling when the notifier cannot watch all of them.
+func (watch *Watch) track(dirs []string) {
+	if err := watch.notify.Watch(dirs); err != nil {
+		watch.notify.Close()
+		watch.notify = poller{watch.config.Clock}
+		watch.report(fmt.Errorf("falling back to polling: %w", err))
+	}
+}
+
+// report calls OnError, when set.
+func (watch *Watch) report(err error) {
+	if watch.config.OnError != nil {
+		watch.config.OnError(err)
+	}
+}
+
+func (watch *Watch) getState() (filetimes, []string) {
+	start := watch.config.Clock.Now()
+	scan := newScanner(watch.config)
+	scan.previous = watch.last
+	if watch.listings != nil {
+		scan.listings = watch.listings
+		scan.listings.Begin(watch.notify.Dirty())
+	}
+	for _, glob := range watch.config.Monitor {
+		if err := scan.IncludeGlob(glob); err != nil {
+			scan.fail(err)
+		}
+	}
+	scan.Wait()
+	if scan.listings != nil {
+		scan.listings.End()
+	}
+	watch.last = scan.times
+
+	stats := scan.Stats()
+	stats.Duration = watch.config.Clock.Now().Sub(start)
+	watch.mu.Lock()
+	watch.stats = stats
+	watch.mu.Unlock()
+	if watch.config.OnStats != nil {
+		watch.config.OnStats(stats)
+	}
+
+	// only report errors that were not there in the previous scan
+	seen := make(map[string]bool, len(scan.errs))
+	for _, err := range scan.errs {
+		seen[err.Error()] = true
+		if !watch.errors[err.Error()] {
+			watch.report(err)
+		}
+	}
+	watch.errors = seen
+
+	return scan.times, scan.Dirs()
+}
 
 func isnav(name string) bool {
 	return name == "." || name == ".."
 }
 
-func matchany(patterns []string, name string) bool {
-	name = cname(name)
-	for _, pattern := range patterns {
-		if match, _ := filepath.Match(pattern, name); match {
-			return true
+// scanner collects the modification times of monitored files
+// and the directories that were visited to find them.
+type scanner struct {
+	ignore    []rule
+	care      []rule
+	recurse   bool
+	filter    func(path string, info fs.FileInfo) bool
+	gitignore bool
+	hash      bool
+	attrs     bool
+	dirs      bool
+	follow    bool
+
+	// fs contains the scanned files
+	fs filesystem
+
+	// root is the directory that anchored patterns are relative to
+	root string
+	// state is the absolute path of the state file, which is skipped
+	state string
+
+	// previous scan for reusing file hashes
+	previous filetimes
+
+	times filetimes
+	// visited directories
+	visited map[string]struct{}
+	// identities of the directories being walked, when following symlinks
+	walking map[dirKey]struct{}
+	errs    []error
+
+	// listings caches directory listings between scans, when incremental
+	listings *listings
+	// prefetch lists directories concurrently, when enabled
+	prefetch *prefetch
+
+	stats    Stats
+	dirSizes []DirStats
+}
+
+// dirKey identifies a directory by inode or, where there are
+// no inodes, by the path with symbolic links resolved.
+type dirKey struct {
+	id   fileID
+	path string
+}
+
+func newScanner(config Config) *scanner {
+	scan := &scanner{
+		fs:        newFilesystem(config.FS),
+		ignore:    compileRules(config.Ignore),
+		care:      compileRules(config.Care),
+		recurse:   config.Recurse,
+		filter:    config.Filter,
+		gitignore: config.GitIgnore,
+		hash:      config.Hash,
+		attrs:     config.Attributes,
+		dirs:      config.Dirs,
+		follow:    config.FollowSymlinks,
+
+		times:   make(filetimes),
+		visited: make(map[string]struct{}),
+		walking: make(map[dirKey]struct{}),
+	}
+	if config.StateFile != "" && config.FS == nil {
+		scan.state, _ = filepath.Abs(config.StateFile)
+	}
+	if config.Concurrency > 1 {
+		scan.prefetch = newPrefetch(config.Concurrency)
+	}
+	return scan
+}
+
+// Wait waits for the directory listings that were started ahead.
+func (scan *scanner) Wait() {
+	if scan.prefetch != nil {
+		scan.prefetch.Wait()
+	}
+}
+
+// Dirs returns the visited directories.
+func (scan *scanner) Dirs() []string {
+	dirs := make([]string, 0, len(scan.visited))
+	for dir := range scan.visited {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// fail records an error that happened while scanning.
+func (scan *scanner) fail(err error) {
+	scan.errs = append(scan.errs, err)
+}
+
+// failNested records an error from scanning a nested folder, unless
+// it was removed during scanning.
+func (scan *scanner) failNested(err error) {
+	if err != nil && !os.IsNotExist(err) {
+		scan.fail(err)
+	}
+}
+
+// splitGlob splits glob into the directory that contains all
+// the matches and the remaining pattern.
+func splitGlob(glob string) (dir, pattern string) {
+	i := metaIndex(glob)
+	if i < 0 {
+		return filepath.Dir(glob), filepath.Base(glob)
+	}
+	separators := "/"
+	if runtime.GOOS == "windows" {
+		separators = `/\`
+	}
+	sep := strings.LastIndexAny(glob[:i], separators)
+	return filepath.Dir(glob[:i]), glob[sep+1:]
+}
+
+// rel returns path relative to the current monitor root.
+func (scan *scanner) rel(path string) string {
+	if scan.root == "." {
+		return path
+	}
+	rel := strings.TrimPrefix(path, scan.root)
+	return strings.TrimLeft(rel, string(filepath.Separator))
+}
+
+// includeBase records the closest existing directory to dir,
+// so that files created later are noticed.
+func (scan *scanner) includeBase(dir string) {
+	for {
+		if f, err := scan.fs.Stat(dir); err == nil && f.IsDir() {
+			scan.visited[dir] = struct{}{}
+			return
 		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
 	}
-	return false
 }
 
-func (times filetimes) IncludeGlob(glob string, ignore, care []string, recurse bool) error {
+// IncludeGlob includes the files and directories matching glob.
+func (scan *scanner) IncludeGlob(glob string) error {
 	if glob == "" {
-		return times.IncludeDir(".", ignore, care, recurse)
+		scan.root = "."
+		return scan.IncludeDir(".")
 	}
 
-	matches, err := filepath.Glob(glob)
+	glob = filepath.Clean(glob)
+	dir, pattern := splitGlob(glob)
+	scan.includeBase(dir)
+
+	if !hasMeta(glob) {
+		scan.root = glob
+		f, err := scan.lstat(glob)
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			if scan.recurse {
+				return scan.IncludeDir(glob)
+			}
+			return nil
+		}
+		if f.Mode().IsRegular() {
+			scan.includeFile(glob, f)
+		}
+		return nil
+	}
+
+	compiled, err := compileGlob(glob)
 	if err != nil {
 		return err
 	}
+	scan.root = dir
 
-	for _, abs := range matches {
-		f, err := os.Lstat(abs)
+	depth := -1
+	if !hasDeepMeta(pattern) {
+		depth = strings.Count(filepath.ToSlash(pattern), "/") + 1
+	}
+	return scan.walkGlob(dir, compiled, depth, scan.rootIgnores(dir))
+}
+
+// lstat returns the info of path, following a
+// symbolic link when following is enabled.
+func (scan *scanner) lstat(path string) (os.FileInfo, error) {
+	if scan.follow {
+		return scan.fs.Stat(path)
+	}
+	return scan.fs.Lstat(path)
+}
+
+// resolve returns the info of the target of a symbolic link when
+// following is enabled, otherwise it returns f unchanged.
+func (scan *scanner) resolve(abs string, f os.FileInfo) (os.FileInfo, error) {
+	if !scan.follow || f.Mode()&os.ModeSymlink == 0 {
+		return f, nil
+	}
+	return scan.fs.Stat(abs)
+}
+
+// enter reports whether dir is not one of the directories being walked
+// and marks it as such until leave. It only tracks directories when
+// following symbolic links, where a link to a parent directory could
+// otherwise lead to scanning forever. A directory reached by several
+// links without a loop is scanned under each of them.
+func (scan *scanner) enter(dir string) (dirKey, bool) {
+	if !scan.follow {
+		return dirKey{}, true
+	}
+	f, err := scan.fs.Stat(dir)
+	if err != nil {
+		return dirKey{}, true
+	}
+
+	key := dirKey{id: fileIDOf(f)}
+	if key.id.IsZero() {
+		key.path, err = scan.fs.EvalSymlinks(dir)
 		if err != nil {
-			continue
+			return dirKey{}, true
 		}
+	}
+	if _, ok := scan.walking[key]; ok {
+		return dirKey{}, false
+	}
+	scan.walking[key] = struct{}{}
+	return key, true
+}
 
-		if recurse && f.IsDir() {
-			times.IncludeDir(abs, ignore, care, recurse)
-		}
-		if f.Mode().IsRegular() {
-			times[cname(abs)] = f.ModTime()
-		}
+// leave unmarks a directory marked by enter.
+func (scan *scanner) leave(key dirKey) {
+	if key != (dirKey{}) {
+		delete(scan.walking, key)
 	}
+}
 
-	return nil
+// skip reports whether an entry found while walking should not be scanned.
+func (scan *scanner) skip(abs, base string, f os.FileInfo, ignores *ignoreList) bool {
+	isDir := f.IsDir()
+	if isnav(base) || base == "" {
+		return true
+	}
+	if scan.gitignore && isDir && base == ".git" {
+		scan.ignored(".git")
+		return true
+	}
+
+	rel := scan.rel(abs)
+	if rule := matchRule(scan.ignore, rel, base, isDir); rule != nil {
+		scan.ignored(rule.pattern)
+		return true
+	}
+	if ignores.Ignored(abs, base, isDir) {
+		scan.ignored(".gitignore")
+		return true
+	}
+	if !isDir && len(scan.care) > 0 && !matchRules(scan.care, rel, base, isDir) {
+		scan.ignored("care")
+		return true
+	}
+	return scan.exclude(abs, base, f)
+}
+
+// exclude reports whether an entry is never scanned, even when
+// a monitored pattern names it directly.
+func (scan *scanner) exclude(abs, base string, f os.FileInfo) bool {
+	if isnav(base) || base == "" {
+		return true
+	}
+	if !f.IsDir() && scan.isState(abs, base) {
+		return true
+	}
+	if scan.filter != nil && !scan.filter(abs, f) {
+		scan.ignored("filter")
+		return true
+	}
+	return false
 }
 
-func (times filetimes) IncludeDir(dir string, ignore, care []string, recurse bool) error {
-	matches, err := ioutil.ReadDir(dir)
+// isState reports whether path is the state file.
+func (scan *scanner) isState(path, base string) bool {
+	if scan.state == "" || base != filepath.Base(scan.state) {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && abs == scan.state
+}
+
+// walkGlob includes entries in dir matching glob, descending
+// at most depth levels or indefinitely when depth is negative.
+func (scan *scanner) walkGlob(dir string, glob *glob, depth int, ignores *ignoreList) error {
+	key, ok := scan.enter(dir)
+	if !ok {
+		return nil
+	}
+	defer scan.leave(key)
+
+	matches, err := scan.readDir(dir)
 	if err != nil {
 		return err
 	}
+	scan.visited[dir] = struct{}{}
+	scan.listed(dir, len(matches))
 
+	var subdirs []subdir
 	for _, f := range matches {
 		base := f.Name()
 		abs := filepath.Join(dir, base)
-		if isnav(base) || base == "" || matchany(ignore, base) {
+		f, err := scan.resolve(abs, f)
+		if err != nil {
 			continue
 		}
-		if !f.IsDir() && len(care) > 0 && !matchany(care, base) {
+		// files that a pattern without ** names directly are scanned
+		// regardless of the ignore and care rules, like a literal path
+		matched := glob.Match(abs)
+		if matched && depth >= 0 && !f.IsDir() {
+			if scan.exclude(abs, base, f) {
+				continue
+			}
+		} else if scan.skip(abs, base, f, ignores) {
 			continue
 		}
 
-		if recurse && f.IsDir() {
-			times.IncludeDir(abs, ignore, care, recurse)
+		if matched {
+			if f.IsDir() {
+				scan.includeSubdir(abs, f)
+			}
+			if scan.recurse && f.IsDir() {
+				subdirs = append(subdirs, subdir{path: abs})
+				continue
+			}
+			if f.Mode().IsRegular() {
+				scan.includeFile(abs, f)
+			}
 		}
-		if f.Mode().IsRegular() {
-			times[cname(abs)] = f.ModTime()
+
+		if f.IsDir() && depth != 1 {
+			subdirs = append(subdirs, subdir{path: abs, glob: glob, depth: depth - 1})
 		}
 	}
-
+	scan.descend(subdirs, ignores)
 	return nil
 }
 
-type Change struct {
-	Kind     string
-	Path     string
-	Modified time.Time
+// includeSubdir records a directory, when directories are included.
+func (scan *scanner) includeSubdir(abs string, f os.FileInfo) {
+	if !scan.dirs {
+		return
+	}
+	scan.times[cname(abs)] = entry{
+		Dir:      true,
+		Modified: f.ModTime(),
+		ID:       fileIDOf(f),
+	}
 }
 
-func (current filetimes) Changes(next filetimes) (changes []Change) {
-	// modified and deleted files
-	for file, time := range current {
-		ntime, nok := next[file]
-		if !nok {
-			changes = append(changes, Change{"delete", file, time})
-			continue
-		}
-		if !ntime.Equal(time) {
-			changes = append(changes, Change{"modify", file, ntime})
-			continue
-		}
+// includeFile records the state of a regular file.
+func (scan *scanner) includeFile(abs string, f os.FileInfo) {
+	name := cname(abs)
+	file := entry{
+		Modified: f.ModTime(),
+		Size:     f.Size(),
+		ID:       fileIDOf(f),
 	}
-	// added files
-	for file, ntime := range next {
-		if _, ok := current[file]; !ok {
-			changes = append(changes, Change{"create", file, ntime})
-			continue
+	if scan.attrs {
+		file.Attributes = true
+		file.Mode = f.Mode()
+		file.ChangeTime = changeTimeOf(f)
+	}
+	if scan.hash {
+		prev, ok := scan.previous[name]
+		if ok && !prev.Hash.IsZero() && prev.Size == file.Size && prev.Modified.Equal(file.Modified) &&
+			prev.ChangeTime.Equal(file.ChangeTime) {
+			file.Hash = prev.Hash
+		} else {
+			file.Hash = hashFile(scan.fs, abs)
 		}
 	}
-	return
+	scan.times[name] = file
 }
 
-func (a filetimes) Same(b filetimes) bool {
-	if len(a) != len(b) {
-		return false
+// IncludeDir includes the files in dir, and its subdirectories when recursing.
+func (scan *scanner) IncludeDir(dir string) error {
+	return scan.includeDir(dir, scan.rootIgnores(dir))
+}
+
+func (scan *scanner) includeDir(dir string, ignores *ignoreList) error {
+	key, ok := scan.enter(dir)
+	if !ok {
+		return nil
 	}
-	for file, time := range a {
-		if !b[file].Equal(time) {
-			return false
+	defer scan.leave(key)
+
+	matches, err := scan.readDir(dir)
+	if err != nil {
+		return err
+	}
+	scan.visited[dir] = struct{}{}
+	scan.listed(dir, len(matches))
+
+	var subdirs []subdir
+	for _, f := range matches {
+		base := f.Name()
+		abs := filepath.Join(dir, base)
+		f, err := scan.resolve(abs, f)
+		if err != nil {
+			continue
+		}
+		if scan.skip(abs, base, f, ignores) {
+			continue
+		}
+
+		if f.IsDir() {
+			scan.includeSubdir(abs, f)
+		}
+		if scan.recurse && f.IsDir() {
+			subdirs = append(subdirs, subdir{path: abs})
+		}
+		if f.Mode().IsRegular() {
+			scan.includeFile(abs, f)
 		}
 	}
-	return true
+	scan.descend(subdirs, ignores)
+
+	return nil
 }
 
 func cname(name string) string {
@@ -0,0 +1,301 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/loov/watchrun/watch/watchtest"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires privileges on windows")
+	}
+
+	shared := createTree(t, "vendor/lib.go")
+	dir := createTree(t, "main.go", "sub/util.go")
+	symlink := func(target, name string) {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink(filepath.Join(shared, "vendor"), "vendor")
+	symlink(filepath.Join(shared, "vendor", "lib.go"), "lib.go")
+	symlink(dir, "sub/loop")
+	symlink(filepath.Join(dir, "missing"), "dangling")
+
+	scan := newScanner(Config{Recurse: true})
+	if err := scan.IncludeGlob(dir); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"main.go", "sub/util.go"}
+	if got := scanned(scan, dir); !reflect.DeepEqual(got, exp) {
+		t.Errorf("not following: got %v, expected %v", got, exp)
+	}
+
+	scan = newScanner(Config{Recurse: true, FollowSymlinks: true})
+	if err := scan.IncludeGlob(dir); err != nil {
+		t.Fatal(err)
+	}
+	exp = []string{"lib.go", "main.go", "sub/util.go", "vendor/lib.go"}
+	if got := scanned(scan, dir); !reflect.DeepEqual(got, exp) {
+		t.Errorf("following: got %v, expected %v", got, exp)
+	}
+
+	// changing the target is reported under the link path
+	previous := scan.times
+	if err := os.WriteFile(filepath.Join(shared, "vendor", "lib.go"), []byte("package vendor"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scan = newScanner(Config{Recurse: true, FollowSymlinks: true})
+	if err := scan.IncludeGlob(dir); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, change := range previous.Changes(scan.times) {
+		rel, _ := filepath.Rel(dir, change.Path)
+		got = append(got, change.Kind+" "+filepath.ToSlash(rel))
+	}
+	if len(got) != 2 || !slices.Contains(got, "modify lib.go") || !slices.Contains(got, "modify vendor/lib.go") {
+		t.Errorf("got %v, expected lib.go and vendor/lib.go to be modified", got)
+	}
+}
+
+func TestFollowSymlinksShared(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires privileges on windows")
+	}
+
+	dir := createTree(t, "shared/lib.go", "api/main.go", "svc/main.go")
+	for _, link := range []string{"api/vendor", "svc/vendor"} {
+		if err := os.Symlink(filepath.Join(dir, "shared"), filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "shared", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := newScanner(Config{Recurse: true, FollowSymlinks: true})
+	if err := scan.IncludeGlob(dir); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"api/main.go", "api/vendor/lib.go", "shared/lib.go", "svc/main.go", "svc/vendor/lib.go"}
+	if got := scanned(scan, dir); !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	const interval = time.Second
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := watchtest.NewClock(at)
+	fsys := fstest.MapFS{"main.go": {ModTime: at}}
+
+	watch, err := Start(Config{
+		FS:       fsys,
+		Clock:    clock,
+		Interval: interval,
+		MaxWait:  3 * interval,
+		Recurse:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		watch.Stop()
+		<-watch.Done()
+	}()
+
+	// step modifies the files while the watcher sleeps and advances the clock
+	step := func(modify func()) {
+		t.Helper()
+		clock.BlockUntil(1)
+		if modify != nil {
+			modify()
+		}
+		clock.Advance(interval)
+	}
+	expect := func(exp ...string) {
+		t.Helper()
+		got := []string{}
+		for _, change := range <-watch.Changes {
+			got = append(got, change.Kind+" "+change.Path)
+		}
+		slices.Sort(got)
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("got %v, expected %v", got, exp)
+		}
+	}
+	touch := func(name string) func() {
+		return func() {
+			fsys[name] = &fstest.MapFile{ModTime: clock.Now()}
+		}
+	}
+
+	// the initial batch is sent after a quiet interval
+	step(nil)
+	expect("create main.go")
+
+	// changes within the quiet period are batched
+	step(touch("a.go"))
+	step(touch("b.go"))
+	step(nil)
+	expect("create a.go", "create b.go")
+
+	// files that keep changing are reported after the maximum wait
+	step(touch("main.go"))
+	step(touch("a.go"))
+	step(touch("b.go"))
+	step(touch("c.go"))
+	expect("create c.go", "modify a.go", "modify b.go", "modify main.go")
+}
+
+func TestWaitStable(t *testing.T) {
+	const interval = time.Second
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := watchtest.NewClock(at)
+	fsys := fstest.MapFS{"main.go": {ModTime: at}}
+
+	watch, err := Start(Config{
+		FS:         fsys,
+		Clock:      clock,
+		Interval:   interval,
+		MaxWait:    3 * interval,
+		WaitStable: 5 * interval,
+		Recurse:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		watch.Stop()
+		<-watch.Done()
+	}()
+
+	// step modifies the files while the watcher sleeps and advances the clock
+	step := func(modify func()) {
+		t.Helper()
+		clock.BlockUntil(1)
+		if modify != nil {
+			modify()
+		}
+		clock.Advance(interval)
+	}
+	expect := func(exp ...string) {
+		t.Helper()
+		got := []string{}
+		for _, change := range <-watch.Changes {
+			got = append(got, change.Kind+" "+change.Path)
+		}
+		slices.Sort(got)
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("got %v, expected %v", got, exp)
+		}
+	}
+	touch := func(name string) func() {
+		return func() {
+			fsys[name] = &fstest.MapFile{ModTime: clock.Now()}
+		}
+	}
+	// grow appends to a file, as when it is being copied
+	grow := func(name string) func() {
+		return func() {
+			var data []byte
+			if file, ok := fsys[name]; ok {
+				data = file.Data
+			}
+			fsys[name] = &fstest.MapFile{Data: append(data, 0), ModTime: clock.Now()}
+		}
+	}
+
+	step(nil)
+	expect("create main.go")
+
+	// the file that is still growing is held back
+	step(func() { touch("a.go")(); grow("big.bin")() })
+	step(grow("big.bin"))
+	step(grow("big.bin"))
+	step(grow("big.bin"))
+	expect("create a.go")
+
+	// and reported once it stops changing
+	step(nil)
+	expect("create big.bin")
+
+	// files that keep changing are held for at most WaitStable,
+	// which is reached on the third maximum wait
+	for i := 0; i < 10; i++ {
+		step(grow("big.bin"))
+	}
+	expect("modify big.bin")
+}
+
+func TestNewContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fsys := fstest.MapFS{"main.go": {}}
+	watch, err := NewContext(ctx, Config{FS: fsys, Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := watch.Err(); err != nil {
+		t.Errorf("running: got %v, expected no error", err)
+	}
+
+	// nobody reads the pending changes
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-watch.Done():
+	case <-time.After(time.Second):
+		t.Fatal("watch did not stop")
+	}
+	if _, ok := <-watch.Changes; ok {
+		t.Error("changes were not closed")
+	}
+	if err := watch.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("stopped: got %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestAdaptiveInterval(t *testing.T) {
+	const second = time.Second
+	watch := &Watch{
+		config:   Config{Interval: second, MaxInterval: 8 * second},
+		interval: second,
+	}
+
+	steps := []struct {
+		changed bool
+		took    time.Duration
+		exp     time.Duration
+	}{
+		// idle
+		{false, 0, 2 * second},
+		{false, 0, 4 * second},
+		{false, 0, 8 * second},
+		{false, 0, 8 * second},
+		// activity
+		{true, 0, second},
+		{false, 0, 2 * second},
+		// slow scans
+		{true, 3 * second, 6 * second},
+		{true, 10 * second, 8 * second},
+		{true, 100 * time.Millisecond, second},
+	}
+	for i, step := range steps {
+		watch.adapt(step.changed, step.took)
+		if watch.interval != step.exp {
+			t.Errorf("%d: got %v, expected %v", i, watch.interval, step.exp)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package watch
+
+import "time"
+
+// notifier wakes up the watcher when the monitored directories might
+// have changed, so that the tree does not need to be rescanned on
+// every interval.
+type notifier interface {
+	// Watch updates the set of watched directories.
+	// An error means that the notifier cannot reliably report changes
+	// for all of them and polling should be used instead.
+	Watch(dirs []string) error
+	// Dirty returns the directories that had events since the previous
+	// call. When known is false, any directory might have changed.
+	Dirty() (dirs map[string]bool, known bool)
+	// Wait blocks until a change might have happened, the timeout
+	// expires or done is closed. It returns false when nothing happened.
+	Wait(done <-chan struct{}, timeout time.Duration) bool
+	// Close releases the resources held by the notifier.
+	Close() error
+}
+
+// poller is a notifier that always reports a possible change after
+// the timeout, which makes the watcher rescan on every interval.
+type poller struct{ clock Clock }
+
+func (poller) Watch(dirs []string) error { return nil }
+
+func (poller) Dirty() (map[string]bool, bool) { return nil, false }
+
+func (poll poller) Wait(done <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-poll.clock.After(timeout):
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (poller) Close() error { return nil }
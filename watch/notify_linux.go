@@ -0,0 +1,210 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+	syscall.IN_ONLYDIR
+
+// filesystems where inotify does not see changes made by other machines
+var remoteFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xfe534d42: "smb2",
+	0xff534d42: "cifs",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+}
+
+var errUnsupportedFilesystem = errors.New("filesystem does not support inotify")
+
+// inotify is a notifier that uses Linux inotify watches.
+type inotify struct {
+	fd   int
+	file *os.File
+	wake chan struct{}
+
+	mu      sync.Mutex
+	watches map[string]int32
+	// paths of each watch, several when symbolic links lead to one directory
+	paths   map[int32]map[string]bool
+	started bool
+
+	// dirty are the directories with events since the last Dirty
+	dirty    map[string]bool
+	overflow bool
+}
+
+func newNotifier() notifier {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return poller{systemClock{}}
+	}
+
+	notify := &inotify{
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		wake: make(chan struct{}, 1),
+
+		watches: make(map[string]int32),
+		paths:   make(map[int32]map[string]bool),
+		dirty:   make(map[string]bool),
+	}
+	go notify.read()
+	return notify
+}
+
+func (notify *inotify) Watch(dirs []string) error {
+	notify.mu.Lock()
+	defer notify.mu.Unlock()
+
+	keep := make(map[string]struct{}, len(dirs))
+	added := false
+	for _, dir := range dirs {
+		keep[dir] = struct{}{}
+		if _, ok := notify.watches[dir]; ok {
+			continue
+		}
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(dir, &stat); err == nil {
+			if _, remote := remoteFilesystems[uint32(stat.Type)]; remote {
+				return errUnsupportedFilesystem
+			}
+		}
+
+		wd, err := syscall.InotifyAddWatch(notify.fd, dir, inotifyMask)
+		if err != nil {
+			switch err {
+			case syscall.ENOENT, syscall.ENOTDIR, syscall.EACCES:
+				// removed or inaccessible since scanning,
+				// the next scan will notice that
+				continue
+			}
+			return err
+		}
+		notify.watches[dir] = int32(wd)
+		if notify.paths[int32(wd)] == nil {
+			notify.paths[int32(wd)] = make(map[string]bool)
+		}
+		notify.paths[int32(wd)][dir] = true
+		// changes before the watch was added are only found by scanning
+		notify.dirty[dir] = true
+		added = true
+	}
+
+	for dir, wd := range notify.watches {
+		if _, ok := keep[dir]; ok {
+			continue
+		}
+		delete(notify.watches, dir)
+		delete(notify.paths[wd], dir)
+		// the directory is still watched under another path
+		if len(notify.paths[wd]) > 0 {
+			continue
+		}
+		_, _ = syscall.InotifyRmWatch(notify.fd, uint32(wd))
+		delete(notify.paths, wd)
+	}
+
+	// files created in a new directory before it was watched
+	// are only found by scanning once more
+	if added && notify.started {
+		notify.signal()
+	}
+	notify.started = true
+
+	return nil
+}
+
+func (notify *inotify) Dirty() (map[string]bool, bool) {
+	notify.mu.Lock()
+	defer notify.mu.Unlock()
+
+	dirty, known := notify.dirty, !notify.overflow
+	notify.dirty = make(map[string]bool)
+	notify.overflow = false
+	return dirty, known
+}
+
+func (notify *inotify) Wait(done <-chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-notify.wake:
+		return true
+	case <-timer.C:
+		return false
+	case <-done:
+		return false
+	}
+}
+
+func (notify *inotify) Close() error {
+	return notify.file.Close()
+}
+
+func (notify *inotify) signal() {
+	select {
+	case notify.wake <- struct{}{}:
+	default:
+	}
+}
+
+// read consumes inotify events until the notifier is closed.
+func (notify *inotify) read() {
+	var buf [64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)]byte
+	for {
+		n, err := notify.file.Read(buf[:])
+		if err != nil {
+			return
+		}
+
+		notify.mu.Lock()
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			notify.handle(event)
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+		notify.mu.Unlock()
+
+		notify.signal()
+	}
+}
+
+// handle records an event, notify.mu must be held.
+func (notify *inotify) handle(event *syscall.InotifyEvent) {
+	if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+		notify.overflow = true
+		return
+	}
+
+	dirs, ok := notify.paths[event.Wd]
+	if !ok {
+		return
+	}
+	for dir := range dirs {
+		notify.dirty[dir] = true
+	}
+
+	// the kernel dropped the watch, because the
+	// directory was deleted or unmounted
+	if event.Mask&syscall.IN_IGNORED != 0 {
+		delete(notify.paths, event.Wd)
+		for dir := range dirs {
+			delete(notify.watches, dir)
+		}
+	}
+}
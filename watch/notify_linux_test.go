@@ -0,0 +1,217 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInotify(t *testing.T) {
+	notify, ok := newNotifier().(*inotify)
+	if !ok {
+		t.Skip("inotify is not available")
+	}
+	defer notify.Close()
+
+	dir := createTree(t, "main.go", "sub/util.go")
+	sub := filepath.Join(dir, "sub")
+	if err := notify.Watch([]string{dir, sub}); err != nil {
+		t.Fatal(err)
+	}
+	// new watches are dirty, since they missed the earlier changes
+	if dirty, known := notify.Dirty(); !known || !dirty[dir] || !dirty[sub] {
+		t.Fatalf("got dirty %v (known %v), expected both directories", dirty, known)
+	}
+
+	expect := func(name string, exp string) {
+		t.Helper()
+		if !notify.Wait(nil, 5*time.Second) {
+			t.Fatalf("%s: Wait timed out", name)
+		}
+		// let the remaining events of the change arrive
+		time.Sleep(10 * time.Millisecond)
+		dirty, known := notify.Dirty()
+		if !known || len(dirty) != 1 || !dirty[exp] {
+			t.Errorf("%s: got dirty %v (known %v), expected %v", name, dirty, known, exp)
+		}
+		// consume the wake up of the remaining events
+		select {
+		case <-notify.wake:
+		default:
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "new.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expect("create", dir)
+
+	if err := os.WriteFile(filepath.Join(sub, "util.go"), []byte("package sub"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expect("modify", sub)
+
+	if notify.Wait(nil, 50*time.Millisecond) {
+		t.Error("Wait returned true without changes")
+	}
+
+	// the kernel drops the watch of a deleted directory
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	if !notify.Wait(nil, 5*time.Second) {
+		t.Fatal("delete: Wait timed out")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if dirty, _ := notify.Dirty(); !dirty[sub] {
+		t.Errorf("delete: got dirty %v, expected %v", dirty, sub)
+	}
+	notify.mu.Lock()
+	_, watched := notify.watches[sub]
+	notify.mu.Unlock()
+	if watched {
+		t.Error("deleted directory is still watched")
+	}
+
+	// after losing events any directory might have changed
+	notify.mu.Lock()
+	notify.handle(&syscall.InotifyEvent{Wd: -1, Mask: syscall.IN_Q_OVERFLOW})
+	notify.mu.Unlock()
+	if _, known := notify.Dirty(); known {
+		t.Error("overflow: expected the dirty directories to be unknown")
+	}
+	if _, known := notify.Dirty(); !known {
+		t.Error("overflow: expected Dirty to reset the overflow")
+	}
+}
+
+// failingNotifier cannot watch any directories.
+type failingNotifier struct {
+	poller
+	err error
+}
+
+func (notify failingNotifier) Watch(dirs []string) error { return notify.err }
+
+func TestTrackFallback(t *testing.T) {
+	for _, err := range []error{syscall.ENOSPC, errUnsupportedFilesystem} {
+		var reported error
+		watch := &Watch{
+			config: Config{
+				Clock:   systemClock{},
+				OnError: func(err error) { reported = err },
+			},
+			notify: failingNotifier{poller{systemClock{}}, err},
+		}
+		watch.track([]string{t.TempDir()})
+
+		if _, ok := watch.notify.(poller); !ok {
+			t.Errorf("%v: got notifier %T, expected poller", err, watch.notify)
+		}
+		if !errors.Is(reported, err) {
+			t.Errorf("%v: got reported %v, expected the error", err, reported)
+		}
+		if !watch.notify.Wait(nil, time.Millisecond) {
+			t.Errorf("%v: the poller should report a possible change after the timeout", err)
+		}
+	}
+}
+
+func TestInotifyAliases(t *testing.T) {
+	notify, ok := newNotifier().(*inotify)
+	if !ok {
+		t.Skip("inotify is not available")
+	}
+	defer notify.Close()
+
+	dir := createTree(t, "shared/lib.go")
+	shared := filepath.Join(dir, "shared")
+	api, svc := filepath.Join(dir, "api"), filepath.Join(dir, "svc")
+	for _, link := range []string{api, svc} {
+		if err := os.Symlink(shared, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	change := func(name string, exp ...string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(shared, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if !notify.Wait(nil, 5*time.Second) {
+			t.Fatalf("%s: Wait timed out", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+		dirty, _ := notify.Dirty()
+		for _, dir := range exp {
+			if !dirty[dir] {
+				t.Errorf("%s: got dirty %v, expected %v", name, dirty, exp)
+			}
+		}
+		select {
+		case <-notify.wake:
+		default:
+		}
+	}
+
+	if err := notify.Watch([]string{shared, api, svc}); err != nil {
+		t.Fatal(err)
+	}
+	notify.Dirty()
+	change("a.go", shared, api, svc)
+
+	// no longer visiting one of the paths keeps watching the others
+	if err := notify.Watch([]string{shared, svc}); err != nil {
+		t.Fatal(err)
+	}
+	change("b.go", shared, svc)
+}
+
+func TestIncrementalAliases(t *testing.T) {
+	if _, ok := newNotifier().(*inotify); !ok {
+		t.Skip("inotify is not available")
+	}
+
+	dir := createTree(t, "shared/lib.go")
+	if err := os.MkdirAll(filepath.Join(dir, "api"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "shared"), filepath.Join(dir, "api", "vendor")); err != nil {
+		t.Fatal(err)
+	}
+
+	watch, err := Start(Config{
+		Monitor:        []string{dir},
+		Interval:       10 * time.Millisecond,
+		Recurse:        true,
+		FollowSymlinks: true,
+		Incremental:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		watch.Stop()
+		<-watch.Done()
+	}()
+	<-watch.Changes
+
+	if err := os.WriteFile(filepath.Join(dir, "shared", "new.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, change := range <-watch.Changes {
+		rel, _ := filepath.Rel(dir, change.Path)
+		got = append(got, change.Kind+" "+filepath.ToSlash(rel))
+	}
+	slices.Sort(got)
+	if exp := []string{"create api/vendor/new.go", "create shared/new.go"}; !slices.Equal(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+}
@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"os"
+	"sync"
+)
+
+// prefetch lists directories ahead of the walk, so that slow listings
+// happen concurrently while the walk itself stays sequential and
+// produces the same results.
+type prefetch struct {
+	// workers limits how many directories are listed at the same time
+	workers chan struct{}
+	// pending listings, only accessed by the walk
+	pending map[string]*fetch
+	// running listings, including ones the walk did not need
+	running sync.WaitGroup
+}
+
+// fetch is the result of listing a directory in the background.
+type fetch struct {
+	done    chan struct{}
+	entries []os.FileInfo
+	err     error
+}
+
+func newPrefetch(concurrency int) *prefetch {
+	return &prefetch{
+		workers: make(chan struct{}, concurrency),
+		pending: make(map[string]*fetch),
+	}
+}
+
+// Start lists dirs in the background using list.
+func (ahead *prefetch) Start(dirs []string, list func(dir string) ([]os.FileInfo, error)) {
+	for _, dir := range dirs {
+		if _, ok := ahead.pending[dir]; ok {
+			continue
+		}
+		result := &fetch{done: make(chan struct{})}
+		ahead.pending[dir] = result
+
+		ahead.running.Add(1)
+		go func(dir string) {
+			defer ahead.running.Done()
+			defer close(result.done)
+
+			ahead.workers <- struct{}{}
+			defer func() { <-ahead.workers }()
+			result.entries, result.err = list(dir)
+		}(dir)
+	}
+}
+
+// Take waits for the listing of dir, when it was started.
+func (ahead *prefetch) Take(dir string) (entries []os.FileInfo, ok bool, err error) {
+	result, ok := ahead.pending[dir]
+	if !ok {
+		return nil, false, nil
+	}
+	delete(ahead.pending, dir)
+	<-result.done
+	return result.entries, true, result.err
+}
+
+// Wait waits for all the listings to finish.
+func (ahead *prefetch) Wait() {
+	ahead.running.Wait()
+}
+
+// subdir is a directory to walk after the entries of its parent.
+type subdir struct {
+	path string
+	// glob to match the entries with, nil includes all of them
+	glob  *glob
+	depth int
+}
+
+// readDir lists dir, using the listing started ahead when there is one.
+func (scan *scanner) readDir(dir string) ([]os.FileInfo, error) {
+	if scan.prefetch != nil {
+		if entries, ok, err := scan.prefetch.Take(dir); ok {
+			return entries, err
+		}
+	}
+	return scan.listDir(dir)
+}
+
+// descend walks the subdirectories of a directory in order,
+// listing them concurrently when enabled.
+func (scan *scanner) descend(subdirs []subdir, ignores *ignoreList) {
+	if scan.prefetch != nil && len(subdirs) > 1 {
+		dirs := make([]string, len(subdirs))
+		for i, sub := range subdirs {
+			dirs[i] = sub.path
+		}
+		scan.prefetch.Start(dirs, scan.listDir)
+	}
+
+	for _, sub := range subdirs {
+		nested := scan.enterDir(ignores, sub.path)
+		if sub.glob == nil {
+			scan.failNested(scan.includeDir(sub.path, nested))
+		} else {
+			scan.failNested(scan.walkGlob(sub.path, sub.glob, sub.depth, nested))
+		}
+	}
+}
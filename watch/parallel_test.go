@@ -0,0 +1,83 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestConcurrency(t *testing.T) {
+	dir := createTree(t,
+		"main.go", "README.md",
+		"a/a.go", "a/b/b.go", "a/b/c/c.go", "a/b/c/d/d.go",
+		"e/e.go", "e/f/f.txt", "e/g/g.go", "h/i/j/k.go",
+	)
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "e", "link")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(dir, filepath.Join(dir, "h", "loop")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type result struct {
+		times   filetimes
+		visited []string
+		errs    []error
+	}
+	scan := func(config Config, globs ...string) result {
+		scan := newScanner(config)
+		for _, glob := range globs {
+			if err := scan.IncludeGlob(glob); err != nil {
+				scan.fail(err)
+			}
+		}
+		scan.Wait()
+		return result{scan.times, scan.Dirs(), scan.errs}
+	}
+
+	configs := map[string]Config{
+		"recurse": {Recurse: true},
+		"dirs":    {Recurse: true, Dirs: true},
+		"follow":  {Recurse: true, FollowSymlinks: true},
+		"ignore":  {Recurse: true, Ignore: []string{"b/", "*.txt"}},
+	}
+	globs := [][]string{
+		{dir},
+		{filepath.Join(dir, "**", "*.go")},
+		{filepath.Join(dir, "*", "*")},
+		{filepath.Join(dir, "a"), filepath.Join(dir, "a", "**")},
+	}
+	for name, config := range configs {
+		for _, glob := range globs {
+			sequential := scan(config, glob...)
+			for _, concurrency := range []int{2, 4, 16} {
+				config := config
+				config.Concurrency = concurrency
+				if parallel := scan(config, glob...); !reflect.DeepEqual(sequential, parallel) {
+					t.Errorf("%s %v with concurrency %d:\ngot      %v\nexpected %v", name, glob, concurrency, parallel, sequential)
+				}
+			}
+		}
+	}
+}
+
+func benchmarkConcurrency(b *testing.B, concurrency int) {
+	root := benchmarkTree(b, 20, 20)
+	config := Config{Ignore: DefaultIgnore, Recurse: true, Concurrency: concurrency}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scan := newScanner(config)
+		if err := scan.IncludeGlob(root); err != nil {
+			b.Fatal(err)
+		}
+		scan.Wait()
+	}
+}
+
+func BenchmarkScanSequential(b *testing.B) { benchmarkConcurrency(b, 1) }
+func BenchmarkScanConcurrent(b *testing.B) { benchmarkConcurrency(b, runtime.NumCPU()) }
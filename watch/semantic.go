@@ -0,0 +1,162 @@
+package watch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// GoSemantic tells apart changes to Go files that affect the code
+// from the ones that only touch comments and formatting.
+// It is not safe for concurrent use.
+type GoSemantic struct {
+	fs filesystem
+	// fingerprints of the syntax of the Go files seen so far
+	fingerprints map[string]hash
+}
+
+// NewGoSemantic returns a GoSemantic that reads the files from fsys,
+// which should be the same as Config.FS. A nil fsys reads from the disk.
+func NewGoSemantic(fsys fs.FS) *GoSemantic {
+	return &GoSemantic{
+		fs:           newFilesystem(fsys),
+		fingerprints: make(map[string]hash),
+	}
+}
+
+// Filter returns the changes without the modified Go files whose
+// syntax is the same, ignoring comments and formatting. When all
+// the changes are such files, the result is empty.
+func (semantic *GoSemantic) Filter(changes []Change) []Change {
+	var kept []Change
+	for _, change := range changes {
+		if change.Dir || filepath.Ext(change.Path) != ".go" {
+			kept = append(kept, change)
+			continue
+		}
+		if change.OldPath != "" {
+			delete(semantic.fingerprints, change.OldPath)
+		}
+		if change.Kind == "delete" {
+			delete(semantic.fingerprints, change.Path)
+			kept = append(kept, change)
+			continue
+		}
+
+		previous, known := semantic.fingerprints[change.Path]
+		next, ok := semantic.fingerprint(change.Path)
+		if !ok {
+			// keep reporting files that do not parse
+			delete(semantic.fingerprints, change.Path)
+			kept = append(kept, change)
+			continue
+		}
+		semantic.fingerprints[change.Path] = next
+		if change.Kind != "modify" || !known || previous != next {
+			kept = append(kept, change)
+		}
+	}
+	return kept
+}
+
+// fingerprint returns the digest of the syntax of a Go file.
+func (semantic *GoSemantic) fingerprint(path string) (hash, bool) {
+	src, err := readFile(semantic.fs, path)
+	if err != nil {
+		return hash{}, false
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return hash{}, false
+	}
+
+	// comments that change the build are part of the code
+	var buf bytes.Buffer
+	for _, comment := range directives(file) {
+		buf.WriteString(comment)
+		buf.WriteByte('\n')
+	}
+	file.Comments = nil
+
+	// without positions and comments the printer uses the same
+	// layout regardless of the formatting of the source
+	clearPositions(reflect.ValueOf(file))
+
+	if err := printer.Fprint(&buf, token.NewFileSet(), file); err != nil {
+		return hash{}, false
+	}
+	return sha256.Sum256(buf.Bytes()), true
+}
+
+// directives returns the comments of a Go file that affect the build:
+// the build constraints, the //go: and //export directives and the cgo
+// preamble above import "C".
+func directives(file *ast.File) []string {
+	preamble := map[*ast.CommentGroup]bool{}
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			if spec := spec.(*ast.ImportSpec); spec.Path.Value == `"C"` {
+				preamble[decl.Doc] = true
+				preamble[spec.Doc] = true
+			}
+		}
+	}
+
+	var comments []string
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			text := comment.Text
+			if preamble[group] || strings.HasPrefix(text, "//go:") ||
+				strings.HasPrefix(text, "// +build") || strings.HasPrefix(text, "//export ") {
+				comments = append(comments, text)
+			}
+		}
+	}
+	return comments
+}
+
+var (
+	posType      = reflect.TypeOf(token.NoPos)
+	commentsType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+// clearPositions sets all the positions in a syntax tree to token.NoPos
+// and removes the comments attached to nodes. The tree must not have
+// cycles, which holds without object resolution.
+func clearPositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			clearPositions(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if field.Type() == posType {
+				field.SetInt(int64(token.NoPos))
+				continue
+			}
+			if field.Type() == commentsType {
+				field.SetZero()
+				continue
+			}
+			clearPositions(field)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearPositions(v.Index(i))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package watch
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestGoSemantic(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go": {Data: []byte("package main\n\nfunc main() {\n\tprintln(1 + 2)\n}\n")},
+		"app.css": {Data: []byte("body {}")},
+	}
+	semantic := NewGoSemantic(fsys)
+
+	tests := []struct {
+		name   string
+		src    string
+		change Change
+		kept   bool
+	}{
+		{"created", "", Change{Kind: "create", Path: "main.go"}, true},
+		{"other file", "", Change{Kind: "modify", Path: "app.css"}, true},
+		{"comment", "package main\n\n// main prints\nfunc main() {\n\tprintln(1 + 2) // three\n}\n", Change{Kind: "modify", Path: "main.go"}, false},
+		{"formatting", "package main\nfunc main() { println(1+2) }", Change{Kind: "modify", Path: "main.go"}, false},
+		{"code", "package main\nfunc main() { println(1+3) }", Change{Kind: "modify", Path: "main.go"}, true},
+		{"operator", "package main\nfunc main() { println(1-3) }", Change{Kind: "modify", Path: "main.go"}, true},
+		{"syntax error", "package main\nfunc main() {", Change{Kind: "modify", Path: "main.go"}, true},
+		{"fixed", "package main\nfunc main() { println(1-3) }", Change{Kind: "modify", Path: "main.go"}, true},
+		{"build constraint", "//go:build linux\n\npackage main\nfunc main() { println(1-3) }", Change{Kind: "modify", Path: "main.go"}, true},
+		{"other constraint", "//go:build windows\n\npackage main\nfunc main() { println(1-3) }", Change{Kind: "modify", Path: "main.go"}, true},
+		{"legacy constraint", "//go:build windows\n// +build windows\n\npackage main\nfunc main() { println(1-3) }", Change{Kind: "modify", Path: "main.go"}, true},
+		{"embed", "package main\nimport _ \"embed\"\n//go:embed a.txt\nvar s string", Change{Kind: "modify", Path: "main.go"}, true},
+		{"other embed", "package main\nimport _ \"embed\"\n//go:embed b.txt\nvar s string", Change{Kind: "modify", Path: "main.go"}, true},
+		{"generate", "package main\nimport _ \"embed\"\n//go:generate stringer\n//go:embed b.txt\nvar s string", Change{Kind: "modify", Path: "main.go"}, true},
+		{"linkname", "package main\nimport _ \"unsafe\"\n//go:linkname now time.now\nfunc now() int64", Change{Kind: "modify", Path: "main.go"}, true},
+		{"cgo", "package main\n\n// #include <stdio.h>\nimport \"C\"\nfunc main() {}", Change{Kind: "modify", Path: "main.go"}, true},
+		{"cgo preamble", "package main\n\n// #include <stdlib.h>\nimport \"C\"\nfunc main() {}", Change{Kind: "modify", Path: "main.go"}, true},
+		{"cgo comment", "package main\n\n// #include <stdlib.h>\nimport \"C\"\n// main does nothing\nfunc main() {}", Change{Kind: "modify", Path: "main.go"}, false},
+		{"deleted", "", Change{Kind: "delete", Path: "main.go"}, true},
+	}
+	for _, test := range tests {
+		if test.src != "" {
+			fsys["main.go"] = &fstest.MapFile{Data: []byte(test.src)}
+		}
+		kept := semantic.Filter([]Change{test.change})
+		if got := len(kept) == 1; got != test.kept {
+			t.Errorf("%s: got kept %v, expected %v", test.name, got, test.kept)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package watch
+
+import "time"
+
+// trackUnstable records the files whose size or modification
+// time differs between the last two scans.
+func (watch *Watch) trackUnstable(last, next filetimes) {
+	watch.unstable = nil
+	if last == nil {
+		return
+	}
+	for file, info := range next {
+		if info.Dir {
+			continue
+		}
+		prev, ok := last[file]
+		if ok && prev.Size == info.Size && prev.Modified.Equal(info.Modified) {
+			continue
+		}
+		if watch.unstable == nil {
+			watch.unstable = make(map[string]bool)
+		}
+		watch.unstable[file] = true
+	}
+}
+
+// holdUnstable returns next with the files that are still changing
+// reverted to their state in previous, so that they are reported
+// once they stop changing or after they have been held for WaitStable.
+func (watch *Watch) holdUnstable(previous, next filetimes) filetimes {
+	now := watch.config.Clock.Now()
+	holding := make(map[string]time.Time)
+	var held filetimes
+	for file := range watch.unstable {
+		since, ok := watch.holding[file]
+		if !ok {
+			since = now
+		}
+		if now.Sub(since) >= watch.config.WaitStable {
+			continue
+		}
+		holding[file] = since
+
+		if held == nil {
+			held = make(filetimes, len(next))
+			for file, info := range next {
+				held[file] = info
+			}
+		}
+		if info, ok := previous[file]; ok {
+			held[file] = info
+		} else {
+			delete(held, file)
+		}
+	}
+	watch.holding = holding
+
+	if held == nil {
+		return next
+	}
+	return held
+}
@@ -0,0 +1,61 @@
+package watch
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateVersion changes whenever the format of the state file changes.
+const stateVersion = 1
+
+// state is the content of a state file.
+type state struct {
+	Version int
+	Files   filetimes
+}
+
+// loadState reads the files saved by saveState. A missing file is
+// not an error and results in an empty state.
+func loadState(path string) (filetimes, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var saved state
+	if err := gob.NewDecoder(file).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("invalid state file %q: %w", path, err)
+	}
+	if saved.Version != stateVersion {
+		return nil, fmt.Errorf("state file %q has version %d, expected %d", path, saved.Version, stateVersion)
+	}
+	if saved.Files == nil {
+		saved.Files = make(filetimes)
+	}
+	return saved.Files, nil
+}
+
+// saveState writes files to path, replacing the
+// previous state only when writing succeeds.
+func saveState(path string, files filetimes) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := gob.NewEncoder(temp).Encode(state{Version: stateVersion, Files: files}); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,74 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStateFile(t *testing.T) {
+	dir := createTree(t, "main.go", "util.go")
+	state := filepath.Join(dir, "watch.state")
+
+	// run starts a watch, returning the first batch and stopping it
+	run := func(skip bool) ([]Change, bool) {
+		t.Helper()
+		watch, err := Start(Config{
+			Interval:      10 * time.Millisecond,
+			Monitor:       []string{dir},
+			Recurse:       true,
+			StateFile:     state,
+			SkipUnchanged: skip,
+			OnError:       func(err error) { t.Error(err) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			watch.Stop()
+			for range watch.Changes {
+			}
+		}()
+
+		select {
+		case changes := <-watch.Changes:
+			return changes, true
+		case <-time.After(200 * time.Millisecond):
+			return nil, false
+		}
+	}
+	kinds := func(changes []Change) []string {
+		got := []string{}
+		for _, change := range changes {
+			got = append(got, change.Kind+" "+filepath.Base(change.Path))
+		}
+		return got
+	}
+
+	if changes, _ := run(false); len(changes) != 2 {
+		t.Fatalf("initial: got %v, expected both files to be created", kinds(changes))
+	}
+
+	// changes made while not watching
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "main.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "util.go")); err != nil {
+		t.Fatal(err)
+	}
+	changes, _ := run(false)
+	exp := []string{"delete util.go", "modify main.go"}
+	if got := kinds(changes); len(got) != 2 || !reflect.DeepEqual(got, exp) && !reflect.DeepEqual(got, []string{exp[1], exp[0]}) {
+		t.Errorf("restart: got %v, expected %v", got, exp)
+	}
+
+	if changes, ok := run(false); !ok || len(changes) != 0 {
+		t.Errorf("unchanged: got %v, %v, expected an empty batch", kinds(changes), ok)
+	}
+	if changes, ok := run(true); ok {
+		t.Errorf("skip unchanged: got %v, expected no batch", kinds(changes))
+	}
+}
@@ -0,0 +1,65 @@
+package watch
+
+import (
+	"sort"
+	"time"
+)
+
+// maxLargest is how many of the largest directories Stats lists.
+const maxLargest = 5
+
+// Stats describes the work done by a scan.
+type Stats struct {
+	// Files is the number of monitored files.
+	Files int
+	// Dirs is the number of directories listed.
+	Dirs int
+	// Entries is the number of directory entries examined.
+	Entries int
+	// Ignored counts the skipped entries by the ignore pattern that
+	// matched them, and by ".git", ".gitignore", "care" and "filter".
+	Ignored map[string]int
+	// Duration is how long the scan took.
+	Duration time.Duration
+	// Largest are the directories with the most entries, largest first.
+	Largest []DirStats
+}
+
+// DirStats is the number of entries in a directory.
+type DirStats struct {
+	Path    string
+	Entries int
+}
+
+// listed records a listed directory.
+func (scan *scanner) listed(dir string, entries int) {
+	scan.stats.Dirs++
+	scan.stats.Entries += entries
+	scan.dirSizes = append(scan.dirSizes, DirStats{Path: dir, Entries: entries})
+}
+
+// ignored records an entry skipped because of reason.
+func (scan *scanner) ignored(reason string) {
+	if scan.stats.Ignored == nil {
+		scan.stats.Ignored = make(map[string]int)
+	}
+	scan.stats.Ignored[reason]++
+}
+
+// Stats returns the statistics of the scan.
+func (scan *scanner) Stats() Stats {
+	stats := scan.stats
+	stats.Files = len(scan.times)
+	sort.SliceStable(scan.dirSizes, func(i, k int) bool {
+		return scan.dirSizes[i].Entries > scan.dirSizes[k].Entries
+	})
+	stats.Largest = scan.dirSizes[:min(len(scan.dirSizes), maxLargest)]
+	return stats
+}
+
+// Stats returns the statistics of the most recent scan.
+func (watch *Watch) Stats() Stats {
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	return watch.stats
+}
@@ -0,0 +1,45 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestScanStats(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":       {},
+		"main_test.go":  {},
+		"build.log":     {},
+		"debug.log":     {},
+		".gitignore":    {Data: []byte("tmp/\n")},
+		"tmp/cache.bin": {},
+		"web/app.js":    {},
+		"web/app.css":   {},
+		"web/index.htm": {},
+	}
+	scan := newScanner(Config{
+		FS:        fsys,
+		Ignore:    []string{"*.log", "*_test.go"},
+		Recurse:   true,
+		GitIgnore: true,
+	})
+	if err := scan.IncludeGlob("."); err != nil {
+		t.Fatal(err)
+	}
+	scan.Wait()
+
+	stats := scan.Stats()
+	if stats.Files != 5 || stats.Dirs != 2 || stats.Entries != 10 {
+		t.Errorf("got %d files, %d dirs, %d entries, expected 5, 2, 10",
+			stats.Files, stats.Dirs, stats.Entries)
+	}
+	expIgnored := map[string]int{"*.log": 2, "*_test.go": 1, ".gitignore": 1}
+	if !reflect.DeepEqual(stats.Ignored, expIgnored) {
+		t.Errorf("got ignored %v, expected %v", stats.Ignored, expIgnored)
+	}
+	expLargest := []DirStats{{Path: ".", Entries: 7}, {Path: "web", Entries: 3}}
+	if !reflect.DeepEqual(stats.Largest, expLargest) {
+		t.Errorf("got largest %v, expected %v", stats.Largest, expLargest)
+	}
+}
@@ -0,0 +1,199 @@
+package watch
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// Overflow decides what happens to the changes for
+// a subscriber that has fallen behind.
+type Overflow int
+
+const (
+	// Merge combines the pending batches and the new
+	// changes into a single batch, nothing is lost.
+	Merge Overflow = iota
+	// DropOldest discards the oldest pending batch.
+	DropOldest
+	// DropNewest discards the new changes.
+	DropNewest
+)
+
+// SubscribeConfig configures a Subscription.
+type SubscribeConfig struct {
+	// Care only about changes to paths that match these globs.
+	// Patterns containing a slash match from the start of Change.Path.
+	Care []string
+	// Filter selects the changes to receive, when set.
+	Filter func(change Change) bool
+
+	// Buffer is how many batches can wait for the
+	// subscriber to receive them, defaults to 1.
+	Buffer int
+	// Overflow decides what happens when the buffer is full.
+	Overflow Overflow
+}
+
+// Subscription receives the changes of a Watch that it cares about.
+type Subscription struct {
+	// Changes is closed when the watch stops or the subscription is closed.
+	Changes <-chan []Change
+
+	hub      *hub
+	changes  chan []Change
+	care     []rule
+	filter   func(change Change) bool
+	overflow Overflow
+}
+
+// hub fans out the changes of a watch to the subscriptions.
+type hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscribe returns a subscription to the changes. After the first
+// call the changes are delivered only to subscriptions and
+// Watch.Changes must not be read. A subscriber that does not keep up
+// does not block the watch or the other subscribers. Empty batches,
+// such as the one after starting, reach every subscription.
+// It returns an error when any of the patterns is invalid.
+func (watch *Watch) Subscribe(config SubscribeConfig) (*Subscription, error) {
+	for _, pattern := range config.Care {
+		if _, _, err := compileRule(pattern); err != nil {
+			return nil, fmt.Errorf("invalid care pattern %q: %w", pattern, err)
+		}
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = 1
+	}
+
+	watch.subscribe.Do(func() {
+		watch.hub = &hub{subs: make(map[*Subscription]struct{})}
+		go watch.hub.run(watch.Changes)
+	})
+
+	changes := make(chan []Change, config.Buffer)
+	sub := &Subscription{
+		Changes:  changes,
+		hub:      watch.hub,
+		changes:  changes,
+		care:     compileRules(config.Care),
+		filter:   config.Filter,
+		overflow: config.Overflow,
+	}
+
+	watch.hub.mu.Lock()
+	defer watch.hub.mu.Unlock()
+	if watch.hub.closed {
+		close(sub.changes)
+	} else {
+		watch.hub.subs[sub] = struct{}{}
+	}
+	return sub, nil
+}
+
+// Close stops receiving changes and closes Changes.
+func (sub *Subscription) Close() {
+	sub.hub.mu.Lock()
+	defer sub.hub.mu.Unlock()
+	if _, ok := sub.hub.subs[sub]; ok {
+		delete(sub.hub.subs, sub)
+		close(sub.changes)
+	}
+}
+
+// run delivers the changes to the subscriptions
+// until the watch stops.
+func (hub *hub) run(changes <-chan []Change) {
+	for batch := range changes {
+		hub.dispatch(batch)
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.closed = true
+	for sub := range hub.subs {
+		close(sub.changes)
+	}
+	hub.subs = nil
+}
+
+// dispatch delivers a batch without waiting for the subscribers.
+func (hub *hub) dispatch(batch []Change) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for sub := range hub.subs {
+		// empty batches, such as the one after starting, reach everyone
+		if len(batch) == 0 {
+			sub.deliver(batch)
+			continue
+		}
+		if selected := sub.selected(batch); len(selected) > 0 {
+			sub.deliver(selected)
+		}
+	}
+}
+
+// selected returns the changes the subscription cares about.
+func (sub *Subscription) selected(batch []Change) []Change {
+	if len(sub.care) == 0 && sub.filter == nil {
+		return batch
+	}
+	var selected []Change
+	for _, change := range batch {
+		if sub.cares(change) {
+			selected = append(selected, change)
+		}
+	}
+	return selected
+}
+
+// cares reports whether the subscription receives the change.
+func (sub *Subscription) cares(change Change) bool {
+	if len(sub.care) > 0 {
+		matches := func(path string) bool {
+			return path != "" && matchRules(sub.care, path, filepath.Base(path), change.Dir)
+		}
+		if !matches(change.Path) && !matches(change.OldPath) {
+			return false
+		}
+	}
+	return sub.filter == nil || sub.filter(change)
+}
+
+// deliver queues a batch, applying the overflow policy when
+// the buffer is full. Only the hub sends to the channel, so
+// there is room after taking out a pending batch.
+func (sub *Subscription) deliver(batch []Change) {
+	for {
+		select {
+		case sub.changes <- batch:
+			return
+		default:
+		}
+
+		switch sub.overflow {
+		case DropNewest:
+			return
+		case DropOldest:
+			select {
+			case <-sub.changes:
+			default:
+			}
+		default:
+			var merged []Change
+			for pending := true; pending; {
+				select {
+				case old := <-sub.changes:
+					merged = append(merged, old...)
+				default:
+					pending = false
+				}
+			}
+			batch = append(merged, batch...)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	watch := &Watch{Changes: make(chan []Change)}
+	subscribe := func(config SubscribeConfig) *Subscription {
+		t.Helper()
+		sub, err := watch.Subscribe(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+	paths := func(batch []Change) []string {
+		got := []string{}
+		for _, change := range batch {
+			got = append(got, change.Kind+" "+change.Path)
+		}
+		return got
+	}
+
+	code := subscribe(SubscribeConfig{Care: []string{"*.go"}, Buffer: 3})
+	deletes := subscribe(SubscribeConfig{
+		Buffer: 3,
+		Filter: func(change Change) bool { return change.Kind == "delete" },
+	})
+	merged := subscribe(SubscribeConfig{Overflow: Merge})
+	oldest := subscribe(SubscribeConfig{Overflow: DropOldest})
+	newest := subscribe(SubscribeConfig{Overflow: DropNewest})
+
+	// nobody reads the subscriptions, which must not block sending
+	batches := [][]Change{
+		{{Kind: "create", Path: "main.go"}, {Kind: "create", Path: "index.html"}},
+		{{Kind: "modify", Path: "index.html"}},
+		{{Kind: "delete", Path: "main.go"}},
+	}
+	for _, batch := range batches {
+		watch.Changes <- batch
+	}
+	close(watch.Changes)
+
+	expect := func(name string, sub *Subscription, exp ...[]string) {
+		t.Helper()
+		got := [][]string{}
+		for batch := range sub.Changes {
+			got = append(got, paths(batch))
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s: got %v, expected %v", name, got, exp)
+		}
+	}
+	expect("care", code,
+		[]string{"create main.go"},
+		[]string{"delete main.go"})
+	expect("filter", deletes,
+		[]string{"delete main.go"})
+	expect("merge", merged,
+		[]string{"create main.go", "create index.html", "modify index.html", "delete main.go"})
+	expect("drop oldest", oldest,
+		[]string{"delete main.go"})
+	expect("drop newest", newest,
+		[]string{"create main.go", "create index.html"})
+
+	if _, ok := <-subscribe(SubscribeConfig{}).Changes; ok {
+		t.Error("subscribing to a stopped watch should close the changes")
+	}
+	if _, err := watch.Subscribe(SubscribeConfig{Care: []string{"[a-"}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestSubscribeEmpty(t *testing.T) {
+	watch := &Watch{Changes: make(chan []Change)}
+	sub, err := watch.Subscribe(SubscribeConfig{Care: []string{"*.go"}, Buffer: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watch.Changes <- []Change{}
+	watch.Changes <- []Change{{Kind: "modify", Path: "index.html"}}
+	close(watch.Changes)
+
+	var got [][]Change
+	for batch := range sub.Changes {
+		got = append(got, batch)
+	}
+	if len(got) != 1 || len(got[0]) != 0 {
+		t.Errorf("got %v, expected only the empty batch", got)
+	}
+}
@@ -0,0 +1,88 @@
+// Package watchtest contains helpers for testing code that uses watch.
+package watchtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock that only moves when advanced,
+// it implements watch.Clock.
+type Clock struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	now     time.Time
+	waiters []waiter
+}
+
+// waiter is a pending call to After.
+type waiter struct {
+	at   time.Time
+	done chan time.Time
+}
+
+// NewClock returns a clock starting at now.
+func NewClock(now time.Time) *Clock {
+	clock := &Clock{now: now}
+	clock.cond.L = &clock.mu
+	return clock
+}
+
+// Now returns the current fake time.
+func (clock *Clock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+// After returns a channel that receives the time once
+// the clock has been advanced by at least d.
+func (clock *Clock) After(d time.Duration) <-chan time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	done := make(chan time.Time, 1)
+	if d <= 0 {
+		done <- clock.now
+		return done
+	}
+	clock.waiters = append(clock.waiters, waiter{at: clock.now.Add(d), done: done})
+	clock.cond.Broadcast()
+	return done
+}
+
+// Sleep blocks until the clock has been advanced by at least d.
+func (clock *Clock) Sleep(d time.Duration) { <-clock.After(d) }
+
+// Advance moves the clock forward by d and wakes up
+// the waiters whose time has come, earliest first.
+func (clock *Clock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = clock.now.Add(d)
+	sort.SliceStable(clock.waiters, func(i, k int) bool {
+		return clock.waiters[i].at.Before(clock.waiters[k].at)
+	})
+
+	pending := clock.waiters[:0]
+	for _, waiter := range clock.waiters {
+		if waiter.at.After(clock.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.done <- waiter.at
+	}
+	clock.waiters = pending
+}
+
+// BlockUntil waits until n calls to After are waiting for the clock,
+// so that advancing it wakes up a goroutine that is known to sleep.
+func (clock *Clock) BlockUntil(n int) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	for len(clock.waiters) < n {
+		clock.cond.Wait()
+	}
+}
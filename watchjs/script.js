@@ -129,6 +129,16 @@
 				inject(change);
 			}
 
+			function rename(change) {
+				var el = findasset(change.oldPath);
+				var asset = makeasset(change.path);
+				if (el && asset) {
+					el.parentNode.replaceChild(asset, el);
+				} else {
+					inject(change);
+				}
+			}
+
 			for (var i = 0; i < changes.length; i++) {
 				var change = changes[i];
 				switch(change.action){
@@ -151,6 +161,9 @@
 					case "modify":
 						modify(change);
 						break;
+					case "rename":
+						rename(change);
+						break;
 				}
 			}
 		}
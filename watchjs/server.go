@@ -1,12 +1,14 @@
 package watchjs
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"net/http"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -28,6 +30,13 @@ type Config struct {
 	Ignore []string
 	// Care only monitor files that match these globs.
 	Care []string
+	// Clock is used for polling, defaults to the real time.
+	Clock watch.Clock
+
+	// Watch subscribes to the changes of an existing watch, instead of
+	// starting a new one. Interval, Monitor, Ignore and Clock are not
+	// used and Care selects the changes from the watch.
+	Watch *watch.Watch
 
 	// URL where the watchjs server is serving on.
 	// Code defaults to using the request.URL otherwise.
@@ -38,7 +47,10 @@ type Config struct {
 	ReconnectInterval time.Duration
 
 	// OnChange should return the URL path for a particular file and the reaction for javascript.
+	// For a rename it is called a second time, with Path set to the old path, to find its URL.
 	OnChange func(change watch.Change) (path string, reaction Action)
+	// OnError is called with errors from scanning the monitored files.
+	OnError func(err error)
 }
 
 // Action defines how browser reacts to a specific file changing.
@@ -72,10 +84,47 @@ type Server struct {
 	config    Config
 	listeners *Hub
 	watch     *watch.Watch
+	// updates receives the changes, from sub when sharing a watch
+	updates <-chan []watch.Change
+	sub     *watch.Subscription
+	// done is closed after the last changes have been dispatched
+	done chan struct{}
+
+	mu sync.Mutex
+	// stopped is why the subscription to a shared watch was closed
+	stopped error
 }
 
 // NewServer creates a new server using the specified config.
+// Invalid globs are reported to OnError and skipped, use
+// NewServerContext to get them as an error instead.
 func NewServer(config Config) *Server {
+	config.Monitor = validGlobs(config.Monitor, config.OnError)
+	config.Ignore = validGlobs(config.Ignore, config.OnError)
+	config.Care = validGlobs(config.Care, config.OnError)
+	server, _ := NewServerContext(context.Background(), config)
+	return server
+}
+
+// validGlobs returns the globs that are valid, reporting the others.
+func validGlobs(globs []string, report func(err error)) []string {
+	valid := globs[:0:0]
+	for _, glob := range globs {
+		if _, err := watch.Match(glob, ""); err != nil {
+			if report != nil {
+				report(fmt.Errorf("invalid pattern %q: %w", glob, err))
+			}
+			continue
+		}
+		valid = append(valid, glob)
+	}
+	return valid
+}
+
+// NewServerContext creates a new server that stops monitoring
+// when ctx is canceled.
+// It returns an error when any of the globs is invalid.
+func NewServerContext(ctx context.Context, config Config) (*Server, error) {
 	if config.OnChange == nil {
 		config.OnChange = DefaultOnChange
 	}
@@ -91,18 +140,48 @@ func NewServer(config Config) *Server {
 	server := &Server{
 		config:    config,
 		listeners: NewHub(),
-		watch: watch.New(
-			config.Interval,
-			config.Monitor,
-			config.Ignore,
-			config.Care,
-			true,
-		),
+		done:      make(chan struct{}),
+	}
+
+	if config.Watch != nil {
+		sub, err := config.Watch.Subscribe(watch.SubscribeConfig{
+			Care:     config.Care,
+			Overflow: watch.Merge,
+		})
+		if err != nil {
+			return nil, err
+		}
+		server.watch = config.Watch
+		server.sub = sub
+		server.updates = sub.Changes
+		if ctx.Done() != nil {
+			go func() {
+				<-ctx.Done()
+				server.stop(context.Cause(ctx))
+			}()
+		}
+	} else {
+		watcher, err := watch.NewContext(ctx, watch.Config{
+			Interval: config.Interval,
+			Monitor:  config.Monitor,
+			Ignore:   config.Ignore,
+			Care:     config.Care,
+			Clock:    config.Clock,
+			Recurse:  true,
+
+			DetectRenames: true,
+			OnError:       config.OnError,
+		})
+		if err != nil {
+			return nil, err
+		}
+		server.watch = watcher
+		server.updates = watcher.Changes
 	}
 
 	go server.monitor()
 
-	return server
+	return server, nil
 }
 
 // DefaultOnChange assumes that your folder structure matches your URL structure.
@@ -120,7 +199,8 @@ func DefaultOnChange(change watch.Change) (string, Action) {
 
 // monitor handles file changes and notifies connections.
 func (server *Server) monitor() {
-	for changeset := range server.watch.Changes {
+	defer close(server.done)
+	for changeset := range server.updates {
 		message := Message{
 			Type: "changes",
 		}
@@ -133,9 +213,20 @@ func (server *Server) monitor() {
 				pkgname = path
 			}
 
+			oldpath := ""
+			if change.OldPath != "" {
+				// only the URL of the old path is used
+				oldpath, _ = server.config.OnChange(watch.Change{
+					Kind:     change.Kind,
+					Path:     change.OldPath,
+					Modified: change.Modified,
+				})
+			}
+
 			message.Data = append(message.Data, Change{
 				Kind:     change.Kind,
 				Path:     path,
+				OldPath:  oldpath,
 				Modified: change.Modified,
 				Action:   action,
 				Package:  pkgname,
@@ -147,11 +238,50 @@ func (server *Server) monitor() {
 	}
 }
 
-// Stop stops changes monitoring.
+// Stop stops changes monitoring. A shared watch keeps running.
 func (server *Server) Stop() {
+	if server.sub != nil {
+		server.stop(context.Canceled)
+		return
+	}
 	server.watch.Stop()
 }
 
+// stop closes the subscription to a shared watch and records why,
+// unless the watch has stopped already.
+func (server *Server) stop(err error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	select {
+	case <-server.done:
+		return
+	default:
+	}
+	if server.stopped == nil {
+		server.stopped = err
+	}
+	server.sub.Close()
+}
+
+// Done returns a channel that is closed after monitoring has stopped.
+func (server *Server) Done() <-chan struct{} { return server.done }
+
+// Err returns nil until Done is closed, and afterwards
+// the reason for stopping, see watch.Watch.Err.
+func (server *Server) Err() error {
+	select {
+	case <-server.done:
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if server.stopped != nil {
+			return server.stopped
+		}
+		return server.watch.Err()
+	default:
+		return nil
+	}
+}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  0,
 	WriteBufferSize: 0,
@@ -229,10 +359,12 @@ type Changes []Change
 
 // Change defines a list of changes.
 type Change struct {
-	// Kind is one of "create", "modify", "delete"
+	// Kind is one of "create", "modify", "delete", "rename"
 	Kind string `json:"kind"`
 	// Path rewriting TODO:
 	Path string `json:"path"`
+	// OldPath is the previous path of a renamed file.
+	OldPath string `json:"oldPath,omitempty"`
 	// Modified returns the modified time of the file.
 	Modified time.Time `json:"modified"`
 	// Action is the action browser should take with this file.
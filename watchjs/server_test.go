@@ -1,9 +1,14 @@
 package watchjs_test
 
 import (
+	"context"
+	"errors"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/loov/watchrun/watch"
 	"github.com/loov/watchrun/watchjs"
 )
 
@@ -40,3 +45,58 @@ func TestFileToURL(t *testing.T) {
 		}
 	}
 }
+
+func TestSharedWatchErr(t *testing.T) {
+	shared, err := watch.Start(watch.Config{
+		FS:       fstest.MapFS{"index.html": {}},
+		Interval: time.Millisecond,
+		Monitor:  []string{"."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Stop()
+
+	server, err := watchjs.NewServerContext(context.Background(), watchjs.Config{Watch: shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Err(); err != nil {
+		t.Errorf("got %v before stopping, expected nil", err)
+	}
+	server.Stop()
+	<-server.Done()
+	if err := server.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v after Stop, expected %v", err, context.Canceled)
+	}
+
+	cause := errors.New("shutdown")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	server, err = watchjs.NewServerContext(ctx, watchjs.Config{Watch: shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel(cause)
+	<-server.Done()
+	if err := server.Err(); err != cause {
+		t.Errorf("got %v after canceling, expected %v", err, cause)
+	}
+
+	if shared.Err() != nil {
+		t.Errorf("the shared watch stopped: %v", shared.Err())
+	}
+}
+
+func TestNewServerInvalidGlobs(t *testing.T) {
+	var reported []error
+	server := watchjs.NewServer(watchjs.Config{
+		Monitor: []string{t.TempDir()},
+		Ignore:  []string{"[z-a]"},
+		OnError: func(err error) { reported = append(reported, err) },
+	})
+	server.Stop()
+	<-server.Done()
+	if len(reported) != 1 {
+		t.Errorf("got %v, expected the invalid ignore pattern to be reported", reported)
+	}
+}